@@ -4,158 +4,500 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 type Configuration interface {
-	Endpoint() string
-	AccessKey() string
-	AccessSecurityKey() string
-	Project() string
-	TraceInstance() string
+	// Destinations are the SLS projects of the namespaces, the first one
+	// receives the data of unknown namespaces.
+	Destinations() []Destination
+	// Routing selects the destinations of the records by their data type,
+	// service, instance and attributes.
+	Routing() Routing
 
 	Topics() []string
 	BootstrapServers() string
 	MetricTopic() string
 	SegmentTopic() string
 	LoggingTopic() string
+	MeterTopic() string
+	CLRMetricTopic() string
+	ProfilingTopic() string
+	BrowserPerfTopic() string
+	BrowserErrorLogTopic() string
+	EventTopic() string
+	// Decoder returns the decoder of the records of a topic, or an empty
+	// string if the topic is unknown.
+	Decoder(topic string) string
+	// Namespace returns the namespace of the records of a topic.
+	Namespace(topic string) string
 	GroupID() string
+	// KafkaProperties are the librdkafka properties of every kafka client,
+	// including the security settings and the pass-through properties.
+	KafkaProperties() map[string]string
+	KafkaAutoOffsetReset() string
+
+	ReceiverType() string
+	GRPCAddress() string
+
+	BatchMaxLogs() int
+	BatchMaxBytes() int
+	BatchLinger() time.Duration
+
+	ShutdownTimeout() time.Duration
+
+	ConvertWorkers() int
+	ExportWorkers() int
+	QueueSize() int
+
+	MetricsAddress() string
+
+	LogLevel() string
+	LogFormat() string
+	LogFile() string
+	LogMaxSize() int
+	LogMaxBackups() int
+	LogMaxAge() int
+
+	DeadLetterType() string
+	DeadLetterTopic() string
+	DeadLetterDirectory() string
+	ExportMaxRetries() int
+	ReplayDeadLetter() bool
+
+	IDEncoding() string
+	KeepOriginalTags() bool
+	ComponentLibraries() string
+	StatusCodes() string
+	DependencyWindow() time.Duration
+	REDMetrics() bool
+	REDBuckets() []float64
+	REDMaxEndpoints() int
+	Sampling() bool
+	SamplingDecisionWait() time.Duration
+	SamplingLatencyThreshold() time.Duration
+	SamplingProbability() float64
+	SamplingServiceProbabilities() map[string]float64
+	SamplingEndpointRateLimit() float64
+	SamplingMaxSpans() int
+	SamplingFallback() string
+	RedactionRules() string
+
+	// PrintConfig reports whether the effective configuration should be
+	// printed instead of running the ingester.
+	PrintConfig() bool
+	// String returns the effective configuration in YAML with the secrets masked.
+	String() string
 }
 
 const (
 	METRIC_TOPIC   = "skywalking-metrics"
 	SEGMENTS_TOPIC = "skywalking-segments"
 	LOGGING_TOPIC  = "skywalking-logging"
+	METER_TOPIC    = "skywalking-meters"
 )
 
-var (
-	endpoint         string
-	ak               string
-	sk               string
-	project          string
-	traceInstance    string
-	namespace        string
-	bootstrapServers string
-	groupID          string
+// Suggested names of the topics which are not consumed unless their templates
+// are set.
+const (
+	// CLR_METRIC_TOPIC .NET agents report to the metric topic like JVM agents,
+	// so their metrics have to be routed to a dedicated topic.
+	CLR_METRIC_TOPIC        = "skywalking-clr-metrics"
+	PROFILING_TOPIC         = "skywalking-profilings"
+	BROWSER_PERF_TOPIC      = "skywalking-browser-perf"
+	BROWSER_ERROR_LOG_TOPIC = "skywalking-browser-error-logs"
+	EVENT_TOPIC             = "skywalking-events"
 )
 
-func InitConfiguration() Configuration {
-	flag.StringVar(&project, "project", os.Getenv("PROJECT"), "Project name")
-	flag.StringVar(&endpoint, "endpoint", os.Getenv("ENDPOINT"), "endpoint")
-	flag.StringVar(&ak, "access-key", os.Getenv("ACCESS_KEY"), "access key")
-	flag.StringVar(&sk, "security-key", os.Getenv("SECURITY_KEY"), "security key")
-	flag.StringVar(&traceInstance, "trace-instance", os.Getenv("TRACE_INSTANCE"), "trace instance")
-	flag.StringVar(&namespace, "namespace", os.Getenv("NAMESPACE"), "namespace")
-	flag.StringVar(&bootstrapServers, "bootstrap servers", os.Getenv("BOOTSTRAP_SERVERS"), "bootstrap servers")
-	flag.StringVar(&groupID, "group", os.Getenv("GROUP"), "consumer group id")
-	flag.Parse()
-
-	if endpoint == "" || len(endpoint) == 0 {
-		fmt.Println("Miss Parameter [endpoint]")
-		os.Exit(-1)
+const (
+	// SLS rejects PutLogs requests carrying more than 4096 logs or 5MB
+	MAX_BATCH_LOGS  = 4096
+	MAX_BATCH_BYTES = 5 * 1024 * 1024
+)
 
-	}
+const (
+	DEFAULT_RED_MAX_ENDPOINTS = 1000
+)
 
-	if ak == "" || len(ak) == 0 {
-		fmt.Println("Miss parameter [access key]")
-		os.Exit(-1)
+const (
+	KAFKA_RECEIVER = "kafka"
+	GRPC_RECEIVER  = "grpc"
+)
 
-	}
+const (
+	ID_ENCODING_SKYWALKING = "skywalking"
+	ID_ENCODING_OTEL       = "otel"
+)
 
-	if sk == "" || len(sk) == 0 {
-		fmt.Println("Miss parameter [access security key]")
-		os.Exit(-1)
-	}
+const (
+	STATUS_CODES_SKYWALKING = "skywalking"
+	STATUS_CODES_OTEL       = "otel"
+)
+
+const (
+	SAMPLING_FALLBACK_KEEP = "keep"
+	SAMPLING_FALLBACK_DROP = "drop"
+)
+
+const (
+	KAFKA_DEAD_LETTER = "kafka"
+	FILE_DEAD_LETTER  = "file"
+)
 
-	if project == "" || len(project) == 0 {
-		fmt.Println("Miss parameter [project]")
-		os.Exit(-1)
+// InitConfiguration loads the configuration file, then the environment, then
+// the command line flags. The configuration is returned along with a
+// *ValidationError listing every problem found.
+func InitConfiguration() (Configuration, error) {
+	c, err := newConfiguration(flag.CommandLine, os.Args[1:])
+	if c == nil {
+		return nil, err
 	}
+	return c, err
+}
 
-	if traceInstance == "" {
-		fmt.Println("Miss parameter [trace instace]")
-		os.Exit(-1)
+// newConfiguration loads the configuration with the flags of fs parsed from
+// args.
+func newConfiguration(fs *flag.FlagSet, args []string) (*configurationImpl, error) {
+	o := defaultOptions()
+	var file string
+	var printConfig bool
+	fs.StringVar(&file, "config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration with the secrets masked and exit")
+	o.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
 
-	if bootstrapServers == "" {
-		fmt.Println("Miss parameter [bootstrap servers]")
-		os.Exit(-1)
+	// The flags have to override the file and the environment, so they are
+	// recorded and set again once the others are loaded.
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	*o = *defaultOptions()
+
+	problems := make([]string, 0)
+	if file != "" {
+		if err := o.load(file); err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to load configuration file %s: %v", file, err))
+		}
 	}
+	problems = append(problems, o.loadEnvironment(fs, flags)...)
+	fs.Visit(func(f *flag.Flag) {
+		if err := f.Value.Set(flags[f.Name]); err != nil {
+			problems = append(problems, fmt.Sprintf("Flag [%s] is invalid: %v", f.Name, err))
+		}
+	})
+	problems = append(problems, o.inheritNamespaces()...)
+	problems = append(problems, o.inheritRouting()...)
+	problems = append(problems, o.validate()...)
+	kafkaProperties, kafkaProblems := o.Kafka.librdkafka()
+	problems = append(problems, kafkaProblems...)
+	namespaces := o.namespaces()
+	topics, topicProblems := newTopicResolver(namespaces)
+	problems = append(problems, topicProblems...)
+	routing, routingProblems := o.Routing.routing()
+	problems = append(problems, routingProblems...)
 
-	if groupID == "" {
-		groupID = "DEFAULT_SKYWALKING_INGESTER_GROUP"
+	destinations := make([]Destination, 0, len(namespaces))
+	for _, n := range namespaces {
+		destinations = append(destinations, n.destination())
 	}
 
-	return &configurationImpl{
-		endpoint:         endpoint,
-		ak:               ak,
-		sk:               sk,
-		project:          project,
-		traceInstance:    traceInstance,
-		namespace:        namespace,
-		groupID:          groupID,
-		bootstrapServers: bootstrapServers,
+	c := &configurationImpl{options: o, destinations: destinations, routing: routing, kafkaProperties: kafkaProperties, topics: topics, printConfig: printConfig}
+	if len(problems) > 0 {
+		return c, &ValidationError{Problems: problems}
 	}
+	return c, nil
 }
 
 type configurationImpl struct {
-	endpoint         string
-	ak               string
-	sk               string
-	project          string
-	traceInstance    string
-	namespace        string
-	groupID          string
-	bootstrapServers string
+	options         *options
+	destinations    []Destination
+	routing         Routing
+	kafkaProperties map[string]string
+	topics          *topicResolver
+	printConfig     bool
 }
 
 func (c *configurationImpl) BootstrapServers() string {
-	return c.bootstrapServers
+	return c.options.Kafka.BootstrapServers
 }
-func (c *configurationImpl) Endpoint() string {
-	return c.endpoint
+func (c *configurationImpl) Topics() []string {
+	return c.topics.topics
 }
 
-func (c *configurationImpl) AccessKey() string {
-	return c.ak
+func (c *configurationImpl) MetricTopic() string {
+	return c.topics.names[DECODER_METRIC]
 }
 
-func (c *configurationImpl) AccessSecurityKey() string {
-	return c.sk
+func (c *configurationImpl) SegmentTopic() string {
+	return c.topics.names[DECODER_SEGMENT]
 }
 
-func (c *configurationImpl) Project() string {
-	return c.project
+func (c *configurationImpl) LoggingTopic() string {
+	return c.topics.names[DECODER_LOGGING]
 }
 
-func (c *configurationImpl) Topics() []string {
-	return []string{c.SegmentTopic(), c.MetricTopic(), c.LoggingTopic()}
+func (c *configurationImpl) MeterTopic() string {
+	return c.topics.names[DECODER_METER]
 }
 
-func (c *configurationImpl) TraceInstance() string {
-	return c.traceInstance
+func (c *configurationImpl) CLRMetricTopic() string {
+	return c.topics.names[DECODER_CLR_METRIC]
 }
 
-func (c *configurationImpl) MetricTopic() string {
-	if c.namespace == "" {
-		return METRIC_TOPIC
-	}
-	return fmt.Sprint("%s-%s", c.namespace, METRIC_TOPIC)
+func (c *configurationImpl) ProfilingTopic() string {
+	return c.topics.names[DECODER_PROFILING]
 }
 
-func (c *configurationImpl) SegmentTopic() string {
-	if c.namespace == "" {
-		return SEGMENTS_TOPIC
+func (c *configurationImpl) BrowserPerfTopic() string {
+	return c.topics.names[DECODER_BROWSER_PERF]
+}
+
+func (c *configurationImpl) BrowserErrorLogTopic() string {
+	return c.topics.names[DECODER_BROWSER_ERROR_LOG]
+}
+
+func (c *configurationImpl) EventTopic() string {
+	return c.topics.names[DECODER_EVENT]
+}
+
+func (c *configurationImpl) Decoder(topic string) string {
+	return c.topics.route(topic).decoder
+}
+
+func (c *configurationImpl) Namespace(topic string) string {
+	return c.topics.route(topic).namespace
+}
+
+func (c *configurationImpl) Destinations() []Destination {
+	return c.destinations
+}
+
+func (c *configurationImpl) Routing() Routing {
+	return c.routing
+}
+
+func (c *configurationImpl) KafkaProperties() map[string]string {
+	return c.kafkaProperties
+}
+
+func (c *configurationImpl) KafkaAutoOffsetReset() string {
+	return c.options.Kafka.AutoOffsetReset
+}
+
+func (c *configurationImpl) GroupID() string {
+	return c.options.Kafka.GroupID
+}
+
+func (c *configurationImpl) ReceiverType() string {
+	return c.options.Receiver.Type
+}
+
+func (c *configurationImpl) GRPCAddress() string {
+	return c.options.Receiver.GRPCAddress
+}
+
+func (c *configurationImpl) BatchMaxLogs() int {
+	return c.options.Pipeline.BatchMaxLogs
+}
+
+func (c *configurationImpl) BatchMaxBytes() int {
+	return c.options.Pipeline.BatchMaxBytes
+}
+
+func (c *configurationImpl) BatchLinger() time.Duration {
+	return c.options.Pipeline.BatchLinger
+}
+
+func (c *configurationImpl) ShutdownTimeout() time.Duration {
+	return c.options.Pipeline.ShutdownTimeout
+}
+
+func (c *configurationImpl) ConvertWorkers() int {
+	return c.options.Pipeline.ConvertWorkers
+}
+
+func (c *configurationImpl) ExportWorkers() int {
+	return c.options.Pipeline.ExportWorkers
+}
+
+func (c *configurationImpl) QueueSize() int {
+	return c.options.Pipeline.QueueSize
+}
+
+func (c *configurationImpl) MetricsAddress() string {
+	return c.options.MetricsAddress
+}
+
+func (c *configurationImpl) LogLevel() string {
+	return c.options.Log.Level
+}
+
+func (c *configurationImpl) LogFormat() string {
+	return c.options.Log.Format
+}
+
+func (c *configurationImpl) LogFile() string {
+	return c.options.Log.File
+}
+
+func (c *configurationImpl) LogMaxSize() int {
+	return c.options.Log.MaxSize
+}
+
+func (c *configurationImpl) LogMaxBackups() int {
+	return c.options.Log.MaxBackups
+}
+
+func (c *configurationImpl) LogMaxAge() int {
+	return c.options.Log.MaxAge
+}
+
+func (c *configurationImpl) DeadLetterType() string {
+	return c.options.DeadLetter.Type
+}
+
+func (c *configurationImpl) DeadLetterTopic() string {
+	return c.options.DeadLetter.Topic
+}
+
+func (c *configurationImpl) DeadLetterDirectory() string {
+	return c.options.DeadLetter.Directory
+}
+
+func (c *configurationImpl) ExportMaxRetries() int {
+	return c.options.Pipeline.ExportMaxRetries
+}
+
+func (c *configurationImpl) ReplayDeadLetter() bool {
+	return c.options.DeadLetter.Replay
+}
+
+func (c *configurationImpl) IDEncoding() string {
+	return c.options.Converter.IDEncoding
+}
+
+func (c *configurationImpl) KeepOriginalTags() bool {
+	return c.options.Converter.KeepOriginalTags
+}
+
+func (c *configurationImpl) ComponentLibraries() string {
+	return c.options.Converter.ComponentLibraries
+}
+
+func (c *configurationImpl) StatusCodes() string {
+	return c.options.Converter.StatusCodes
+}
+
+func (c *configurationImpl) DependencyWindow() time.Duration {
+	return c.options.Converter.DependencyWindow
+}
+
+func (c *configurationImpl) REDMetrics() bool {
+	return c.options.Converter.RED.Enabled
+}
+
+func (c *configurationImpl) REDBuckets() []float64 {
+	return c.options.Converter.RED.Buckets
+}
+
+func (c *configurationImpl) REDMaxEndpoints() int {
+	return c.options.Converter.RED.MaxEndpoints
+}
+
+func (c *configurationImpl) Sampling() bool {
+	return c.options.Sampling.Enabled
+}
+
+func (c *configurationImpl) SamplingDecisionWait() time.Duration {
+	return c.options.Sampling.DecisionWait
+}
+
+func (c *configurationImpl) SamplingLatencyThreshold() time.Duration {
+	return c.options.Sampling.LatencyThreshold
+}
+
+func (c *configurationImpl) SamplingProbability() float64 {
+	return c.options.Sampling.Probability
+}
+
+func (c *configurationImpl) SamplingServiceProbabilities() map[string]float64 {
+	return c.options.Sampling.ServiceProbabilities
+}
+
+func (c *configurationImpl) SamplingEndpointRateLimit() float64 {
+	return c.options.Sampling.EndpointRateLimit
+}
+
+func (c *configurationImpl) SamplingMaxSpans() int {
+	return c.options.Sampling.MaxSpans
+}
+
+func (c *configurationImpl) SamplingFallback() string {
+	return c.options.Sampling.Fallback
+}
+
+func (c *configurationImpl) RedactionRules() string {
+	return c.options.Converter.RedactionRules
+}
+
+func (c *configurationImpl) PrintConfig() bool {
+	return c.printConfig
+}
+
+func (c *configurationImpl) String() string {
+	o := *c.options
+	o.SLS.AccessKey = mask(o.SLS.AccessKey)
+	o.SLS.SecurityKey = mask(o.SLS.SecurityKey)
+	o.Namespaces = make(namespaceList, 0, len(c.options.Namespaces))
+	for _, n := range c.options.Namespaces {
+		n.SLS.AccessKey = mask(n.SLS.AccessKey)
+		n.SLS.SecurityKey = mask(n.SLS.SecurityKey)
+		o.Namespaces = append(o.Namespaces, n)
+	}
+	o.Routing.Destinations = make([]routeDestinationOptions, 0, len(c.options.Routing.Destinations))
+	for _, d := range c.options.Routing.Destinations {
+		d.SLS.AccessKey = mask(d.SLS.AccessKey)
+		d.SLS.SecurityKey = mask(d.SLS.SecurityKey)
+		o.Routing.Destinations = append(o.Routing.Destinations, d)
+	}
+	o.Kafka.SASL.Password = mask(o.Kafka.SASL.Password)
+	o.Kafka.TLS.KeyPassword = mask(o.Kafka.TLS.KeyPassword)
+	o.Kafka.Properties = make(stringMap, len(c.options.Kafka.Properties))
+	for k, v := range c.options.Kafka.Properties {
+		if isSecret(k) {
+			v = mask(v)
+		}
+		o.Kafka.Properties[k] = v
+	}
+
+	data, err := yaml.Marshal(&o)
+	if err != nil {
+		return err.Error()
 	}
-	return fmt.Sprint("%s-%s", c.namespace, SEGMENTS_TOPIC)
+	if c.topics == nil {
+		return string(data)
+	}
+	return fmt.Sprintf("%s# subscribed topics: %s\n", data, strings.Join(c.topics.topics, ", "))
 }
 
-func (c *configurationImpl) LoggingTopic() string {
-	if c.namespace == "" {
-		return LOGGING_TOPIC
+const MASK = "******"
+
+func mask(value string) string {
+	if value == "" {
+		return ""
 	}
-	return fmt.Sprint("%s-%s", c.namespace, LOGGING_TOPIC)
+	return MASK
 }
 
-func (c *configurationImpl) GroupID() string {
-	return c.groupID
+// isSecret reports whether a kafka property holds a password or a private key.
+func isSecret(property string) bool {
+	property = strings.ToLower(property)
+	return strings.Contains(property, "password") || strings.Contains(property, "secret") ||
+		strings.HasSuffix(property, ".key.pem") || strings.HasSuffix(property, ".key")
 }
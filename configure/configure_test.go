@@ -0,0 +1,269 @@
+package configure
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// baseConfig is a valid configuration file.
+const baseConfig = `
+sls:
+  endpoint: cn-hangzhou.log.aliyuncs.com
+  access_key: AK
+  security_key: SK
+  project: top
+  trace_instance: instance
+kafka:
+  bootstrap_servers: localhost:9092
+`
+
+// clearEnvironment unsets the environment variables read by the configuration
+// for the duration of the test.
+func clearEnvironment(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	for _, env := range environments {
+		t.Setenv(env, "")
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return file
+}
+
+func loadConfiguration(t *testing.T, content string, env map[string]string, args ...string) (*configurationImpl, error) {
+	clearEnvironment(t)
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	args = append([]string{"-config", writeConfig(t, content)}, args...)
+	return newConfiguration(flag.NewFlagSet("test", flag.ContinueOnError), args)
+}
+
+func TestConfigurationPrecedence(t *testing.T) {
+	file := baseConfig + `
+pipeline:
+  batch_max_logs: 100
+  export_workers: 2
+`
+	tests := []struct {
+		name        string
+		env         map[string]string
+		args        []string
+		wantProject string
+		wantLogs    int
+		wantWorkers int
+	}{
+		{
+			name:        "file",
+			wantProject: "top",
+			wantLogs:    100,
+			wantWorkers: 2,
+		},
+		{
+			name:        "environment over file",
+			env:         map[string]string{"PROJECT": "env", "BATCH_MAX_LOGS": "200"},
+			wantProject: "env",
+			wantLogs:    200,
+			wantWorkers: 2,
+		},
+		{
+			name:        "flag over environment",
+			env:         map[string]string{"PROJECT": "env", "BATCH_MAX_LOGS": "200"},
+			args:        []string{"-project", "flag"},
+			wantProject: "flag",
+			wantLogs:    200,
+			wantWorkers: 2,
+		},
+		{
+			name:        "flag over file",
+			args:        []string{"-export-workers", "8"},
+			wantProject: "top",
+			wantLogs:    100,
+			wantWorkers: 8,
+		},
+		{
+			name:        "flag set to its default",
+			env:         map[string]string{"BATCH_MAX_LOGS": "200"},
+			args:        []string{"-batch-max-logs", "2048"},
+			wantProject: "top",
+			wantLogs:    2048,
+			wantWorkers: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfiguration(t, file, tt.env, tt.args...)
+			if err != nil {
+				t.Fatalf("newConfiguration() error = %v", err)
+			}
+			if project := c.Destinations()[0].Project; project != tt.wantProject {
+				t.Errorf("project = %s, want %s", project, tt.wantProject)
+			}
+			if logs := c.BatchMaxLogs(); logs != tt.wantLogs {
+				t.Errorf("BatchMaxLogs() = %d, want %d", logs, tt.wantLogs)
+			}
+			if workers := c.ExportWorkers(); workers != tt.wantWorkers {
+				t.Errorf("ExportWorkers() = %d, want %d", workers, tt.wantWorkers)
+			}
+		})
+	}
+}
+
+func TestConfigurationValidationError(t *testing.T) {
+	file := `
+sls:
+  endpoint: cn-hangzhou.log.aliyuncs.com
+  trace_instance: instance
+receiver:
+  type: http
+log:
+  format: xml
+`
+	_, err := loadConfiguration(t, file, map[string]string{"BATCH_MAX_LOGS": "many"}, "-batch-linger", "0s")
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("newConfiguration() error = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"Environment [BATCH_MAX_LOGS] is invalid: parse error",
+		"Miss parameter [access key]",
+		"Miss parameter [access security key]",
+		"Miss parameter [project]",
+		"Unknown receiver type http",
+		"Parameter [batch linger] should be positive",
+		"Parameter [log format] should be console or json",
+	}
+	if !reflect.DeepEqual(validationError.Problems, want) {
+		t.Errorf("problems = %q, want %q", validationError.Problems, want)
+	}
+}
+
+func TestConfigurationDefaultTopics(t *testing.T) {
+	c, err := loadConfiguration(t, baseConfig, nil)
+	if err != nil {
+		t.Fatalf("newConfiguration() error = %v", err)
+	}
+	want := []string{SEGMENTS_TOPIC, METRIC_TOPIC, LOGGING_TOPIC, METER_TOPIC}
+	if topics := c.Topics(); !reflect.DeepEqual(topics, want) {
+		t.Errorf("Topics() = %v, want %v", topics, want)
+	}
+
+	c, err = loadConfiguration(t, baseConfig, map[string]string{"EVENT_TOPIC": EVENT_TOPIC})
+	if err != nil {
+		t.Fatalf("newConfiguration() error = %v", err)
+	}
+	if topic := c.EventTopic(); topic != EVENT_TOPIC {
+		t.Errorf("EventTopic() = %s, want %s", topic, EVENT_TOPIC)
+	}
+}
+
+func TestNamespacesMergeByName(t *testing.T) {
+	file := baseConfig + `
+namespaces:
+  - name: dev
+    sls:
+      project: devproj
+      access_key: DEVAK
+  - name: staging
+    sls:
+      project: stagingproj
+`
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		// want maps the namespaces to their projects and access keys
+		want []string
+	}{
+		{
+			name: "file",
+			want: []string{"dev/devproj/DEVAK", "staging/stagingproj/AK"},
+		},
+		{
+			name: "environment",
+			env:  map[string]string{"NAMESPACES": "dev,prod"},
+			want: []string{"dev/devproj/DEVAK", "prod/top/AK"},
+		},
+		{
+			name: "flag",
+			env:  map[string]string{"NAMESPACES": "dev,prod"},
+			args: []string{"-namespaces", "prod, staging"},
+			want: []string{"prod/top/AK", "staging/stagingproj/AK"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfiguration(t, file, tt.env, tt.args...)
+			if err != nil {
+				t.Fatalf("newConfiguration() error = %v", err)
+			}
+			got := make([]string, 0)
+			for _, d := range c.Destinations() {
+				got = append(got, d.Namespace+"/"+d.Project+"/"+d.AccessKey)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("destinations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringMapSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    stringMap
+		wantErr bool
+	}{
+		{value: "a=1, b=2", want: stringMap{"a": "1", "b": "2"}},
+		{value: "debug=consumer,cgrp", want: stringMap{"debug": "consumer,cgrp"}},
+		{value: "debug=consumer, cgrp,fetch.wait.max.ms=100", want: stringMap{"debug": "consumer,cgrp", "fetch.wait.max.ms": "100"}},
+		{value: "sasl.oauthbearer.config=principal=admin", want: stringMap{"sasl.oauthbearer.config": "principal=admin"}},
+		{value: "consumer,debug=cgrp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			m := stringMap{}
+			err := m.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(m, tt.want) {
+				t.Errorf("Set() = %v, want %v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestKafkaManagedProperties(t *testing.T) {
+	file := baseConfig + `  properties:
+    group.id: other
+    fetch.wait.max.ms: "100"
+  property_files:
+    enable.auto.commit: /run/secrets/auto-commit
+`
+	_, err := loadConfiguration(t, file, nil)
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("newConfiguration() error = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"Kafka property [enable.auto.commit] is managed by the ingester",
+		"Kafka property [group.id] is managed by the ingester",
+	}
+	if !reflect.DeepEqual(validationError.Problems, want) {
+		t.Errorf("problems = %q, want %q", validationError.Problems, want)
+	}
+}
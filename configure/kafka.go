@@ -0,0 +1,161 @@
+package configure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+var securityProtocols = map[string]bool{
+	"plaintext":      true,
+	"ssl":            true,
+	"sasl_plaintext": true,
+	"sasl_ssl":       true,
+}
+
+// autoOffsetResets are the values of auto.offset.reset accepted by librdkafka.
+var autoOffsetResets = map[string]bool{
+	"smallest":  true,
+	"earliest":  true,
+	"beginning": true,
+	"largest":   true,
+	"latest":    true,
+	"end":       true,
+	"error":     true,
+}
+
+// managedProperties are the librdkafka properties the ingester sets itself, the
+// offsets are committed once the data is exported.
+var managedProperties = map[string]bool{
+	"bootstrap.servers":  true,
+	"group.id":           true,
+	"enable.auto.commit": true,
+}
+
+// librdkafka resolves the librdkafka properties shared by the consumers and
+// the producer, reading the secrets from their files, and returns the
+// problems found.
+func (o *kafkaOptions) librdkafka() (map[string]string, []string) {
+	properties := make(map[string]string)
+	problems := make([]string, 0)
+
+	if o.SecurityProtocol != "" {
+		if !securityProtocols[strings.ToLower(o.SecurityProtocol)] {
+			problems = append(problems, fmt.Sprint("Unknown kafka security protocol ", o.SecurityProtocol))
+		}
+		properties["security.protocol"] = o.SecurityProtocol
+	}
+
+	if o.SASL.Mechanism != "" {
+		if !strings.HasPrefix(strings.ToLower(o.SecurityProtocol), "sasl_") {
+			problems = append(problems, "Parameter [kafka sasl mechanism] requires [kafka security protocol] sasl_plaintext or sasl_ssl")
+		}
+		properties["sasl.mechanisms"] = o.SASL.Mechanism
+	}
+
+	if o.SASL.Username != "" {
+		properties["sasl.username"] = o.SASL.Username
+	}
+
+	if password, err := secret(o.SASL.Password, o.SASL.PasswordFile); err != nil {
+		problems = append(problems, fmt.Sprintf("Parameter [kafka sasl password] is invalid: %v", err))
+	} else if password != "" {
+		properties["sasl.password"] = password
+	}
+
+	if o.TLS.CAFile != "" {
+		properties["ssl.ca.location"] = o.TLS.CAFile
+	}
+
+	if (o.TLS.CertFile == "") != (o.TLS.KeyFile == "") {
+		problems = append(problems, "Parameter [kafka cert file] and [kafka key file] should be set together")
+	}
+
+	if o.TLS.CertFile != "" {
+		properties["ssl.certificate.location"] = o.TLS.CertFile
+	}
+
+	if o.TLS.KeyFile != "" {
+		properties["ssl.key.location"] = o.TLS.KeyFile
+	}
+
+	if password, err := secret(o.TLS.KeyPassword, o.TLS.KeyPasswordFile); err != nil {
+		problems = append(problems, fmt.Sprintf("Parameter [kafka key password] is invalid: %v", err))
+	} else if password != "" {
+		properties["ssl.key.password"] = password
+	}
+
+	if o.AutoOffsetReset == "" {
+		o.AutoOffsetReset = defaultOptions().Kafka.AutoOffsetReset
+	}
+
+	if !autoOffsetResets[o.AutoOffsetReset] {
+		problems = append(problems, fmt.Sprint("Unknown kafka auto offset reset ", o.AutoOffsetReset))
+	}
+
+	for k, v := range o.Properties {
+		properties[k] = v
+	}
+
+	names := make([]string, 0, len(o.PropertyFiles))
+	for k := range o.PropertyFiles {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	problems = append(problems, managedPropertyProblems(o.Properties, o.PropertyFiles)...)
+	for _, k := range names {
+		if managedProperties[k] {
+			continue
+		}
+		v, err := readSecret(o.PropertyFiles[k])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Kafka property [%s] is invalid: %v", k, err))
+			continue
+		}
+		properties[k] = v
+	}
+
+	return properties, problems
+}
+
+// managedPropertyProblems reports the properties overriding the ones the
+// ingester manages.
+func managedPropertyProblems(properties ...stringMap) []string {
+	keys := make(map[string]bool)
+	for _, p := range properties {
+		for k := range p {
+			if managedProperties[k] {
+				keys[k] = true
+			}
+		}
+	}
+
+	problems := make([]string, 0, len(keys))
+	for k := range keys {
+		problems = append(problems, fmt.Sprintf("Kafka property [%s] is managed by the ingester", k))
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// secret returns the value, or the content of the file if the value is empty.
+func secret(value string, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("both the value and the file %s are set", file)
+	}
+	if file == "" {
+		return value, nil
+	}
+	return readSecret(file)
+}
+
+// readSecret reads a secret from a file, ignoring the trailing line break
+// mounted secrets usually end with.
+func readSecret(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
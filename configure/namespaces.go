@@ -0,0 +1,165 @@
+package configure
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Destination is the SLS project and logstores the data of a namespace, or of
+// a route, is exported to.
+type Destination struct {
+	Namespace string
+	// Name is the name of a routing destination, it is empty for the
+	// destinations of the namespaces
+	Name                 string
+	Endpoint             string
+	AccessKey            string
+	AccessSecurityKey    string
+	Project              string
+	TraceInstance        string
+	TracesLogstore       string
+	MetricsLogstore      string
+	LogsLogstore         string
+	DependenciesLogstore string
+}
+
+// Logstore returns the logstore of a data type, named as modules.DataType, or
+// an empty string if the data is not exported.
+func (d *Destination) Logstore(dataType string) string {
+	switch dataType {
+	case "trace":
+		return d.TracesLogstore
+	case "metric":
+		return d.MetricsLogstore
+	case "logging":
+		return d.LogsLogstore
+	case "dependency":
+		return d.DependenciesLogstore
+	}
+	return ""
+}
+
+// namespaceOptions are the topics and the destination of a namespace. Keys
+// missing from a namespace are inherited from the top level sls and topic
+// options, except the topic decoders.
+type namespaceOptions struct {
+	Name   string       `yaml:"name"`
+	SLS    slsOptions   `yaml:"sls"`
+	Topics topicOptions `yaml:"topics"`
+	// raw keeps the keys set in the configuration file, they are applied on
+	// top of the inherited options once the environment and the flags are
+	// loaded
+	raw yaml.MapSlice
+}
+
+// namespaceFields decodes the keys of a namespace without capturing them.
+type namespaceFields namespaceOptions
+
+func (n *namespaceOptions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&n.raw)
+}
+
+// namespaceList is a list of namespaces set by comma separated names. The
+// namespaces already listed, e.g. by the configuration file, keep their
+// options, the others inherit every option.
+type namespaceList []namespaceOptions
+
+func (l *namespaceList) String() string {
+	if l == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*l))
+	for _, n := range *l {
+		names = append(names, n.name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *namespaceList) Set(value string) error {
+	listed := make(map[string]namespaceOptions, len(*l))
+	for _, n := range *l {
+		listed[n.name()] = n
+	}
+
+	namespaces := make(namespaceList, 0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		n, ok := listed[name]
+		if !ok {
+			n = namespaceOptions{Name: name, raw: yaml.MapSlice{{Key: "name", Value: name}}}
+		}
+		namespaces = append(namespaces, n)
+	}
+	*l = namespaces
+	return nil
+}
+
+// name returns the name of a namespace, which is only decoded from the
+// configuration file once the namespace is inherited.
+func (n *namespaceOptions) name() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	for _, item := range n.raw {
+		if item.Key == "name" {
+			return fmt.Sprint(item.Value)
+		}
+	}
+	return ""
+}
+
+// inheritNamespaces resolves the options of every namespace.
+func (o *options) inheritNamespaces() []string {
+	if len(o.Namespaces) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0)
+	if o.Kafka.Namespace != "" {
+		problems = append(problems, "Parameter [namespace] and [namespaces] should not be set together")
+	}
+	if len(o.Kafka.Topics.Decoders) > 0 {
+		problems = append(problems, "Parameter [topic decoders] should be set per namespace when [namespaces] is set")
+	}
+
+	for i, n := range o.Namespaces {
+		resolved := namespaceFields{SLS: o.SLS, Topics: o.Kafka.Topics}
+		resolved.Topics.Decoders = nil
+		data, err := yaml.Marshal(n.raw)
+		if err == nil {
+			err = yaml.UnmarshalStrict(data, &resolved)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Namespace %d is invalid: %v", i, err))
+		}
+		resolved.raw = n.raw
+		o.Namespaces[i] = namespaceOptions(resolved)
+	}
+	return problems
+}
+
+// namespaces returns the namespaces to consume. Without namespaces, the top
+// level options make up the only namespace.
+func (o *options) namespaces() []namespaceOptions {
+	if len(o.Namespaces) == 0 {
+		return []namespaceOptions{{Name: o.Kafka.Namespace, SLS: o.SLS, Topics: o.Kafka.Topics}}
+	}
+	return o.Namespaces
+}
+
+func (n *namespaceOptions) destination() Destination {
+	return Destination{
+		Namespace:            n.Name,
+		Endpoint:             n.SLS.Endpoint,
+		AccessKey:            n.SLS.AccessKey,
+		AccessSecurityKey:    n.SLS.SecurityKey,
+		Project:              n.SLS.Project,
+		TraceInstance:        n.SLS.TraceInstance,
+		TracesLogstore:       n.SLS.Logstores.Traces,
+		MetricsLogstore:      n.SLS.Logstores.Metrics,
+		LogsLogstore:         n.SLS.Logstores.Logs,
+		DependenciesLogstore: n.SLS.Logstores.Dependencies,
+	}
+}
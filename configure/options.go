@@ -0,0 +1,476 @@
+package configure
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// options holds every setting of the ingester. It is filled from the
+// configuration file, then the environment, then the command line flags.
+type options struct {
+	SLS            slsOptions        `yaml:"sls"`
+	Kafka          kafkaOptions      `yaml:"kafka"`
+	Namespaces     namespaceList     `yaml:"namespaces"`
+	Routing        routingOptions    `yaml:"routing"`
+	Receiver       receiverOptions   `yaml:"receiver"`
+	Pipeline       pipelineOptions   `yaml:"pipeline"`
+	MetricsAddress string            `yaml:"metrics_address"`
+	Log            logOptions        `yaml:"log"`
+	DeadLetter     deadLetterOptions `yaml:"dead_letter"`
+	Converter      converterOptions  `yaml:"converter"`
+	Sampling       samplingOptions   `yaml:"sampling"`
+}
+
+type slsOptions struct {
+	Endpoint      string          `yaml:"endpoint"`
+	AccessKey     string          `yaml:"access_key"`
+	SecurityKey   string          `yaml:"security_key"`
+	Project       string          `yaml:"project"`
+	TraceInstance string          `yaml:"trace_instance"`
+	Logstores     logstoreOptions `yaml:"logstores"`
+}
+
+// logstoreOptions are derived from the trace instance if empty.
+type logstoreOptions struct {
+	Traces       string `yaml:"traces"`
+	Metrics      string `yaml:"metrics"`
+	Logs         string `yaml:"logs"`
+	Dependencies string `yaml:"dependencies"`
+}
+
+type kafkaOptions struct {
+	BootstrapServers string       `yaml:"bootstrap_servers"`
+	GroupID          string       `yaml:"group_id"`
+	Namespace        string       `yaml:"namespace"`
+	Topics           topicOptions `yaml:"topics"`
+	SecurityProtocol string       `yaml:"security_protocol"`
+	SASL             saslOptions  `yaml:"sasl"`
+	TLS              tlsOptions   `yaml:"tls"`
+	AutoOffsetReset  string       `yaml:"auto_offset_reset"`
+	// Properties are librdkafka properties overriding the defaults of the
+	// consumers and the producer
+	Properties stringMap `yaml:"properties"`
+	// PropertyFiles are librdkafka properties read from files, so that secrets
+	// can be mounted instead of being written in the configuration
+	PropertyFiles stringMap `yaml:"property_files"`
+}
+
+type saslOptions struct {
+	Mechanism    string `yaml:"mechanism"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+type tlsOptions struct {
+	CAFile          string `yaml:"ca_file"`
+	CertFile        string `yaml:"cert_file"`
+	KeyFile         string `yaml:"key_file"`
+	KeyPassword     string `yaml:"key_password"`
+	KeyPasswordFile string `yaml:"key_password_file"`
+}
+
+type receiverOptions struct {
+	Type        string `yaml:"type"`
+	GRPCAddress string `yaml:"grpc_address"`
+}
+
+type pipelineOptions struct {
+	ConvertWorkers   int           `yaml:"convert_workers"`
+	ExportWorkers    int           `yaml:"export_workers"`
+	QueueSize        int           `yaml:"queue_size"`
+	BatchMaxLogs     int           `yaml:"batch_max_logs"`
+	BatchMaxBytes    int           `yaml:"batch_max_bytes"`
+	BatchLinger      time.Duration `yaml:"batch_linger"`
+	ExportMaxRetries int           `yaml:"export_max_retries"`
+	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+}
+
+type logOptions struct {
+	Level      string `yaml:"level"`
+	Format     string `yaml:"format"`
+	File       string `yaml:"file"`
+	MaxSize    int    `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+	MaxAge     int    `yaml:"max_age"`
+}
+
+type deadLetterOptions struct {
+	Type      string `yaml:"type"`
+	Topic     string `yaml:"topic"`
+	Directory string `yaml:"directory"`
+	// Replay is a mode of a single run, it is only set by a flag
+	Replay bool `yaml:"-"`
+}
+
+type converterOptions struct {
+	IDEncoding         string        `yaml:"id_encoding"`
+	KeepOriginalTags   bool          `yaml:"keep_original_tags"`
+	ComponentLibraries string        `yaml:"component_libraries"`
+	StatusCodes        string        `yaml:"status_codes"`
+	DependencyWindow   time.Duration `yaml:"dependency_window"`
+	RED                redOptions    `yaml:"red"`
+	RedactionRules     string        `yaml:"redaction_rules"`
+}
+
+type redOptions struct {
+	Enabled      bool      `yaml:"enabled"`
+	Buckets      floatList `yaml:"buckets"`
+	MaxEndpoints int       `yaml:"max_endpoints"`
+}
+
+type samplingOptions struct {
+	Enabled              bool          `yaml:"enabled"`
+	DecisionWait         time.Duration `yaml:"decision_wait"`
+	LatencyThreshold     time.Duration `yaml:"latency_threshold"`
+	Probability          float64       `yaml:"probability"`
+	ServiceProbabilities probabilities `yaml:"service_probabilities"`
+	EndpointRateLimit    float64       `yaml:"endpoint_rate_limit"`
+	MaxSpans             int           `yaml:"max_spans"`
+	Fallback             string        `yaml:"fallback"`
+}
+
+func defaultOptions() *options {
+	return &options{
+		Kafka: kafkaOptions{
+			GroupID: "DEFAULT_SKYWALKING_INGESTER_GROUP",
+			Topics: topicOptions{
+				Segments: SEGMENTS_TOPIC,
+				Metrics:  METRIC_TOPIC,
+				Logging:  LOGGING_TOPIC,
+				Meters:   METER_TOPIC,
+			},
+			AutoOffsetReset: "latest",
+		},
+		Receiver: receiverOptions{
+			Type:        KAFKA_RECEIVER,
+			GRPCAddress: ":11800",
+		},
+		Pipeline: pipelineOptions{
+			ConvertWorkers:  4,
+			ExportWorkers:   4,
+			QueueSize:       1000,
+			BatchMaxLogs:    2048,
+			BatchMaxBytes:   3 * 1024 * 1024,
+			BatchLinger:     time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		MetricsAddress: ":8080",
+		Log: logOptions{
+			Level:      "info",
+			Format:     "console",
+			MaxSize:    100,
+			MaxBackups: 5,
+			MaxAge:     7,
+		},
+		DeadLetter: deadLetterOptions{
+			Topic: "skywalking-ingester-dead-letter",
+		},
+		Converter: converterOptions{
+			IDEncoding:       ID_ENCODING_SKYWALKING,
+			KeepOriginalTags: true,
+			StatusCodes:      STATUS_CODES_SKYWALKING,
+			RED: redOptions{
+				Enabled:      true,
+				Buckets:      floatList{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+				MaxEndpoints: DEFAULT_RED_MAX_ENDPOINTS,
+			},
+		},
+		Sampling: samplingOptions{
+			DecisionWait: 10 * time.Second,
+			Probability:  1,
+			MaxSpans:     200000,
+			Fallback:     SAMPLING_FALLBACK_KEEP,
+		},
+	}
+}
+
+// bind registers a flag for every option which can be set from the command line.
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.SLS.Project, "project", o.SLS.Project, "Project name")
+	fs.StringVar(&o.SLS.Endpoint, "endpoint", o.SLS.Endpoint, "endpoint")
+	fs.StringVar(&o.SLS.AccessKey, "access-key", o.SLS.AccessKey, "access key")
+	fs.StringVar(&o.SLS.SecurityKey, "security-key", o.SLS.SecurityKey, "security key")
+	fs.StringVar(&o.SLS.TraceInstance, "trace-instance", o.SLS.TraceInstance, "trace instance")
+	fs.StringVar(&o.SLS.Logstores.Traces, "traces-logstore", o.SLS.Logstores.Traces, "logstore of spans, <trace instance>-traces if empty")
+	fs.StringVar(&o.SLS.Logstores.Metrics, "metrics-logstore", o.SLS.Logstores.Metrics, "logstore of metrics, <trace instance>-metrics if empty")
+	fs.StringVar(&o.SLS.Logstores.Logs, "logs-logstore", o.SLS.Logstores.Logs, "logstore of logs, <trace instance>-logs if empty")
+	fs.StringVar(&o.SLS.Logstores.Dependencies, "dependencies-logstore", o.SLS.Logstores.Dependencies, "logstore of service dependencies, <trace instance>-dependencies if empty")
+	fs.StringVar(&o.Kafka.Namespace, "namespace", o.Kafka.Namespace, "namespace")
+	fs.Var(&o.Namespaces, "namespaces", "comma separated namespaces consumed by one ingester, exported with the settings of the configuration file, or the top level settings for namespaces missing from it")
+	fs.StringVar(&o.Kafka.BootstrapServers, "bootstrap-servers", o.Kafka.BootstrapServers, "bootstrap servers")
+	fs.StringVar(&o.Kafka.GroupID, "group", o.Kafka.GroupID, "consumer group id")
+	fs.StringVar(&o.Kafka.Topics.Segments, "segment-topic", o.Kafka.Topics.Segments, "topic template of segments, not consumed if empty")
+	fs.StringVar(&o.Kafka.Topics.Metrics, "metric-topic", o.Kafka.Topics.Metrics, "topic template of JVM metrics, not consumed if empty")
+	fs.StringVar(&o.Kafka.Topics.Logging, "logging-topic", o.Kafka.Topics.Logging, "topic template of logs, not consumed if empty")
+	fs.StringVar(&o.Kafka.Topics.Meters, "meter-topic", o.Kafka.Topics.Meters, "topic template of meters, not consumed if empty")
+	fs.StringVar(&o.Kafka.Topics.CLRMetrics, "clr-metric-topic", o.Kafka.Topics.CLRMetrics, "topic template of CLR metrics, not consumed by default, e.g. "+CLR_METRIC_TOPIC)
+	fs.StringVar(&o.Kafka.Topics.Profilings, "profiling-topic", o.Kafka.Topics.Profilings, "topic template of profiling snapshots, not consumed by default, e.g. "+PROFILING_TOPIC)
+	fs.StringVar(&o.Kafka.Topics.BrowserPerf, "browser-perf-topic", o.Kafka.Topics.BrowserPerf, "topic template of browser performance data, not consumed by default, e.g. "+BROWSER_PERF_TOPIC)
+	fs.StringVar(&o.Kafka.Topics.BrowserErrorLogs, "browser-error-log-topic", o.Kafka.Topics.BrowserErrorLogs, "topic template of browser error logs, not consumed by default, e.g. "+BROWSER_ERROR_LOG_TOPIC)
+	fs.StringVar(&o.Kafka.Topics.Events, "event-topic", o.Kafka.Topics.Events, "topic template of events, not consumed by default, e.g. "+EVENT_TOPIC)
+	fs.Var(&o.Kafka.Topics.Decoders, "topic-decoders", "comma separated topic=decoder of extra topics, topics starting with ^ are regular expressions")
+	fs.StringVar(&o.Kafka.SecurityProtocol, "kafka-security-protocol", o.Kafka.SecurityProtocol, "protocol to communicate with kafka, one of plaintext/ssl/sasl_plaintext/sasl_ssl")
+	fs.StringVar(&o.Kafka.SASL.Mechanism, "kafka-sasl-mechanism", o.Kafka.SASL.Mechanism, "SASL mechanism, one of PLAIN/SCRAM-SHA-256/SCRAM-SHA-512")
+	fs.StringVar(&o.Kafka.SASL.Username, "kafka-sasl-username", o.Kafka.SASL.Username, "SASL username")
+	fs.StringVar(&o.Kafka.SASL.Password, "kafka-sasl-password", o.Kafka.SASL.Password, "SASL password")
+	fs.StringVar(&o.Kafka.SASL.PasswordFile, "kafka-sasl-password-file", o.Kafka.SASL.PasswordFile, "file of the SASL password")
+	fs.StringVar(&o.Kafka.TLS.CAFile, "kafka-ca-file", o.Kafka.TLS.CAFile, "CA certificate file verifying the kafka brokers")
+	fs.StringVar(&o.Kafka.TLS.CertFile, "kafka-cert-file", o.Kafka.TLS.CertFile, "client certificate file")
+	fs.StringVar(&o.Kafka.TLS.KeyFile, "kafka-key-file", o.Kafka.TLS.KeyFile, "client private key file")
+	fs.StringVar(&o.Kafka.TLS.KeyPassword, "kafka-key-password", o.Kafka.TLS.KeyPassword, "password of the client private key")
+	fs.StringVar(&o.Kafka.TLS.KeyPasswordFile, "kafka-key-password-file", o.Kafka.TLS.KeyPasswordFile, "file of the password of the client private key")
+	fs.StringVar(&o.Kafka.AutoOffsetReset, "kafka-auto-offset-reset", o.Kafka.AutoOffsetReset, "where to consume when the group has no committed offset, earliest or latest")
+	fs.Var(&o.Kafka.Properties, "kafka-properties", "comma separated property=value of librdkafka")
+	fs.Var(&o.Kafka.PropertyFiles, "kafka-property-files", "comma separated property=file of librdkafka properties read from files")
+	fs.StringVar(&o.Receiver.Type, "receiver", o.Receiver.Type, "receiver type, kafka or grpc")
+	fs.StringVar(&o.Receiver.GRPCAddress, "grpc-address", o.Receiver.GRPCAddress, "listen address of grpc receiver")
+	fs.IntVar(&o.Pipeline.BatchMaxLogs, "batch-max-logs", o.Pipeline.BatchMaxLogs, "max logs of a PutLogs request")
+	fs.IntVar(&o.Pipeline.BatchMaxBytes, "batch-max-bytes", o.Pipeline.BatchMaxBytes, "max bytes of a PutLogs request")
+	fs.DurationVar(&o.Pipeline.BatchLinger, "batch-linger", o.Pipeline.BatchLinger, "max time logs are buffered before sending")
+	fs.DurationVar(&o.Pipeline.ShutdownTimeout, "shutdown-timeout", o.Pipeline.ShutdownTimeout, "max time to drain data on shutdown")
+	fs.IntVar(&o.Pipeline.ConvertWorkers, "convert-workers", o.Pipeline.ConvertWorkers, "number of converter workers")
+	fs.IntVar(&o.Pipeline.ExportWorkers, "export-workers", o.Pipeline.ExportWorkers, "number of exporter workers")
+	fs.IntVar(&o.Pipeline.QueueSize, "queue-size", o.Pipeline.QueueSize, "queue depth of each worker")
+	fs.IntVar(&o.Pipeline.ExportMaxRetries, "export-max-retries", o.Pipeline.ExportMaxRetries, "max retries of a failed export before it is dead-lettered, retries forever if 0")
+	fs.StringVar(&o.MetricsAddress, "metrics-address", o.MetricsAddress, "listen address of the prometheus metrics endpoint")
+	fs.StringVar(&o.Log.Level, "log-level", o.Log.Level, "log level, one of debug/info/warn/error")
+	fs.StringVar(&o.Log.Format, "log-format", o.Log.Format, "log format, console or json")
+	fs.StringVar(&o.Log.File, "log-file", o.Log.File, "log file path, logs to stdout if empty")
+	fs.IntVar(&o.Log.MaxSize, "log-max-size", o.Log.MaxSize, "max size in megabytes of a log file before it is rotated")
+	fs.IntVar(&o.Log.MaxBackups, "log-max-backups", o.Log.MaxBackups, "max number of rotated log files to keep")
+	fs.IntVar(&o.Log.MaxAge, "log-max-age", o.Log.MaxAge, "max days to keep rotated log files")
+	fs.StringVar(&o.DeadLetter.Type, "dead-letter", o.DeadLetter.Type, "dead letter sink, kafka or file, disabled if empty")
+	fs.StringVar(&o.DeadLetter.Topic, "dead-letter-topic", o.DeadLetter.Topic, "kafka topic of dead letters")
+	fs.StringVar(&o.DeadLetter.Directory, "dead-letter-dir", o.DeadLetter.Directory, "directory of dead letter files")
+	fs.BoolVar(&o.DeadLetter.Replay, "replay-dead-letter", o.DeadLetter.Replay, "re-inject the dead letters into the pipeline and exit")
+	fs.StringVar(&o.Converter.IDEncoding, "id-encoding", o.Converter.IDEncoding, "encoding of trace and span ids, skywalking or otel")
+	fs.BoolVar(&o.Converter.KeepOriginalTags, "keep-original-tags", o.Converter.KeepOriginalTags, "keep the SkyWalking tags mapped to OpenTelemetry attributes")
+	fs.StringVar(&o.Converter.ComponentLibraries, "component-libraries", o.Converter.ComponentLibraries, "component-libraries.yml overriding the built-in component names")
+	fs.StringVar(&o.Converter.StatusCodes, "status-codes", o.Converter.StatusCodes, "status codes of spans, skywalking (SUCCESS/ERROR) or otel (UNSET/ERROR)")
+	fs.DurationVar(&o.Converter.DependencyWindow, "dependency-window", o.Converter.DependencyWindow, "window of the service dependencies aggregated from segment references, 0 to disable, the dependencies logstore has to be created first")
+	fs.BoolVar(&o.Converter.RED.Enabled, "red-metrics", o.Converter.RED.Enabled, "aggregate request, error and duration metrics from entry spans")
+	fs.Var(&o.Converter.RED.Buckets, "red-buckets", "comma separated duration buckets of the RED metrics in milliseconds")
+	fs.IntVar(&o.Converter.RED.MaxEndpoints, "red-max-endpoints", o.Converter.RED.MaxEndpoints, "max endpoints of a service in the RED metrics, 0 for unlimited")
+	fs.StringVar(&o.Converter.RedactionRules, "redaction-rules", o.Converter.RedactionRules, "file of the rules redacting span tags, span logs and log records")
+	fs.BoolVar(&o.Sampling.Enabled, "sampling", o.Sampling.Enabled, "sample traces after their segments are buffered for the decision wait")
+	fs.DurationVar(&o.Sampling.DecisionWait, "sampling-decision-wait", o.Sampling.DecisionWait, "time segments of a trace are buffered before it is sampled")
+	fs.DurationVar(&o.Sampling.LatencyThreshold, "sampling-latency-threshold", o.Sampling.LatencyThreshold, "keep traces with a span at least this slow, 0 to disable")
+	fs.Float64Var(&o.Sampling.Probability, "sampling-probability", o.Sampling.Probability, "probability healthy traces are kept")
+	fs.Var(&o.Sampling.ServiceProbabilities, "sampling-service-probabilities", "comma separated service=probability overriding the sampling probability")
+	fs.Float64Var(&o.Sampling.EndpointRateLimit, "sampling-endpoint-rate-limit", o.Sampling.EndpointRateLimit, "max healthy traces kept per second of each endpoint, 0 for unlimited")
+	fs.IntVar(&o.Sampling.MaxSpans, "sampling-max-spans", o.Sampling.MaxSpans, "max spans buffered for sampling")
+	fs.StringVar(&o.Sampling.Fallback, "sampling-fallback", o.Sampling.Fallback, "decision of segments arriving while the buffer is full, keep or drop")
+}
+
+// environments maps the flags to the environment variables setting them.
+var environments = map[string]string{
+	"project":                        "PROJECT",
+	"endpoint":                       "ENDPOINT",
+	"access-key":                     "ACCESS_KEY",
+	"security-key":                   "SECURITY_KEY",
+	"trace-instance":                 "TRACE_INSTANCE",
+	"traces-logstore":                "TRACES_LOGSTORE",
+	"metrics-logstore":               "METRICS_LOGSTORE",
+	"logs-logstore":                  "LOGS_LOGSTORE",
+	"dependencies-logstore":          "DEPENDENCIES_LOGSTORE",
+	"namespace":                      "NAMESPACE",
+	"namespaces":                     "NAMESPACES",
+	"bootstrap-servers":              "BOOTSTRAP_SERVERS",
+	"group":                          "GROUP",
+	"segment-topic":                  "SEGMENT_TOPIC",
+	"metric-topic":                   "METRIC_TOPIC",
+	"logging-topic":                  "LOGGING_TOPIC",
+	"meter-topic":                    "METER_TOPIC",
+	"clr-metric-topic":               "CLR_METRIC_TOPIC",
+	"profiling-topic":                "PROFILING_TOPIC",
+	"browser-perf-topic":             "BROWSER_PERF_TOPIC",
+	"browser-error-log-topic":        "BROWSER_ERROR_LOG_TOPIC",
+	"event-topic":                    "EVENT_TOPIC",
+	"topic-decoders":                 "TOPIC_DECODERS",
+	"kafka-security-protocol":        "KAFKA_SECURITY_PROTOCOL",
+	"kafka-sasl-mechanism":           "KAFKA_SASL_MECHANISM",
+	"kafka-sasl-username":            "KAFKA_SASL_USERNAME",
+	"kafka-sasl-password":            "KAFKA_SASL_PASSWORD",
+	"kafka-sasl-password-file":       "KAFKA_SASL_PASSWORD_FILE",
+	"kafka-ca-file":                  "KAFKA_CA_FILE",
+	"kafka-cert-file":                "KAFKA_CERT_FILE",
+	"kafka-key-file":                 "KAFKA_KEY_FILE",
+	"kafka-key-password":             "KAFKA_KEY_PASSWORD",
+	"kafka-key-password-file":        "KAFKA_KEY_PASSWORD_FILE",
+	"kafka-auto-offset-reset":        "KAFKA_AUTO_OFFSET_RESET",
+	"kafka-properties":               "KAFKA_PROPERTIES",
+	"kafka-property-files":           "KAFKA_PROPERTY_FILES",
+	"receiver":                       "RECEIVER",
+	"grpc-address":                   "GRPC_ADDRESS",
+	"batch-max-logs":                 "BATCH_MAX_LOGS",
+	"batch-max-bytes":                "BATCH_MAX_BYTES",
+	"batch-linger":                   "BATCH_LINGER",
+	"shutdown-timeout":               "SHUTDOWN_TIMEOUT",
+	"convert-workers":                "CONVERT_WORKERS",
+	"export-workers":                 "EXPORT_WORKERS",
+	"queue-size":                     "QUEUE_SIZE",
+	"export-max-retries":             "EXPORT_MAX_RETRIES",
+	"metrics-address":                "METRICS_ADDRESS",
+	"log-level":                      "LOG_LEVEL",
+	"log-format":                     "LOG_FORMAT",
+	"log-file":                       "LOG_FILE",
+	"log-max-size":                   "LOG_MAX_SIZE",
+	"log-max-backups":                "LOG_MAX_BACKUPS",
+	"log-max-age":                    "LOG_MAX_AGE",
+	"dead-letter":                    "DEAD_LETTER",
+	"dead-letter-topic":              "DEAD_LETTER_TOPIC",
+	"dead-letter-dir":                "DEAD_LETTER_DIR",
+	"id-encoding":                    "ID_ENCODING",
+	"keep-original-tags":             "KEEP_ORIGINAL_TAGS",
+	"component-libraries":            "COMPONENT_LIBRARIES",
+	"status-codes":                   "STATUS_CODES",
+	"dependency-window":              "DEPENDENCY_WINDOW",
+	"red-metrics":                    "RED_METRICS",
+	"red-buckets":                    "RED_BUCKETS",
+	"red-max-endpoints":              "RED_MAX_ENDPOINTS",
+	"redaction-rules":                "REDACTION_RULES",
+	"sampling":                       "SAMPLING",
+	"sampling-decision-wait":         "SAMPLING_DECISION_WAIT",
+	"sampling-latency-threshold":     "SAMPLING_LATENCY_THRESHOLD",
+	"sampling-probability":           "SAMPLING_PROBABILITY",
+	"sampling-service-probabilities": "SAMPLING_SERVICE_PROBABILITIES",
+	"sampling-endpoint-rate-limit":   "SAMPLING_ENDPOINT_RATE_LIMIT",
+	"sampling-max-spans":             "SAMPLING_MAX_SPANS",
+	"sampling-fallback":              "SAMPLING_FALLBACK",
+}
+
+// load reads a YAML or JSON configuration file, keys missing from the file
+// keep their current values.
+func (o *options) load(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, o)
+}
+
+// loadEnvironment sets the options from the environment variables, except the
+// ones overridden by the flags, and returns the variables which failed to
+// parse.
+func (o *options) loadEnvironment(fs *flag.FlagSet, flags map[string]string) []string {
+	problems := make([]string, 0)
+	for name, env := range environments {
+		value := os.Getenv(env)
+		if _, ok := flags[name]; value == "" || ok {
+			continue
+		}
+		f := fs.Lookup(name)
+		previous := f.Value.String()
+		if err := f.Value.Set(value); err != nil {
+			// numeric flags are zeroed by an invalid value
+			f.Value.Set(previous)
+			problems = append(problems, fmt.Sprintf("Environment [%s] is invalid: %v", env, err))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// floatList is a list of floats set by a comma separated flag.
+type floatList []float64
+
+func (l *floatList) String() string {
+	if l == nil {
+		return ""
+	}
+	values := make([]string, 0, len(*l))
+	for _, v := range *l {
+		values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *floatList) Set(value string) error {
+	values := make(floatList, 0)
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+	*l = values
+	return nil
+}
+
+// probabilities is a map of probabilities set by comma separated key=probability pairs.
+type probabilities map[string]float64
+
+func (p *probabilities) String() string {
+	if p == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*p))
+	for k, v := range *p {
+		pairs = append(pairs, k+"="+strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (p *probabilities) Set(value string) error {
+	values := make(probabilities)
+	for _, s := range strings.Split(value, ",") {
+		i := strings.LastIndex(s, "=")
+		if i < 0 {
+			return fmt.Errorf("%s is not service=probability", s)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if err != nil {
+			return err
+		}
+		values[strings.TrimSpace(s[:i])] = v
+	}
+	*p = values
+	return nil
+}
+
+// stringMap is a map of strings set by comma separated key=value pairs. A comma
+// only separates pairs when a key= follows it, so values can be lists such as
+// debug=consumer,cgrp.
+type stringMap map[string]string
+
+func (m *stringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *stringMap) Set(value string) error {
+	values := make(stringMap)
+	key := ""
+	for _, s := range strings.Split(value, ",") {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			if key == "" {
+				return fmt.Errorf("%s is not key=value", s)
+			}
+			values[key] += "," + strings.TrimSpace(s)
+			continue
+		}
+		key = strings.TrimSpace(s[:i])
+		values[key] = strings.TrimSpace(s[i+1:])
+	}
+	*m = values
+	return nil
+}
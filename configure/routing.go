@@ -0,0 +1,188 @@
+package configure
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DEFAULT_DESTINATION names the destination of the namespace of a record in
+// the routes.
+const DEFAULT_DESTINATION = "default"
+
+// dataTypes are the data types the routes match, named as modules.DataType.
+var dataTypes = []string{"trace", "metric", "logging", "dependency"}
+
+func isDataType(t string) bool {
+	for _, dataType := range dataTypes {
+		if t == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// Route selects the destinations of the records matching every condition set.
+type Route struct {
+	// Types are the data types matched, every type is matched if empty
+	Types   map[string]bool
+	Service *regexp.Regexp
+	// Instance is the exact service instance matched
+	Instance string
+	// Attributes are the span attributes, the log tags or the metric labels
+	// matched
+	Attributes   map[string]string
+	Destinations []string
+}
+
+// Routing sends the records to the destinations of the first matching route,
+// or to the default destinations.
+type Routing struct {
+	// Destinations are named by their Name
+	Destinations []Destination
+	Routes       []Route
+	Default      []string
+}
+
+type routingOptions struct {
+	Destinations []routeDestinationOptions `yaml:"destinations"`
+	Routes       []routeOptions            `yaml:"routes"`
+	// Default are the destinations of the records matching no route, the
+	// destination of their namespace if empty
+	Default []string `yaml:"default"`
+}
+
+// routeDestinationOptions inherit the endpoint and the credentials of the top
+// level sls options.
+type routeDestinationOptions struct {
+	Name string     `yaml:"name"`
+	SLS  slsOptions `yaml:"sls"`
+	raw  yaml.MapSlice
+}
+
+// routeDestinationFields decodes the keys of a destination without capturing
+// them.
+type routeDestinationFields routeDestinationOptions
+
+func (d *routeDestinationOptions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&d.raw)
+}
+
+type routeOptions struct {
+	Types        []string  `yaml:"types"`
+	Service      string    `yaml:"service"`
+	Instance     string    `yaml:"instance"`
+	Attributes   stringMap `yaml:"attributes"`
+	Destinations []string  `yaml:"destinations"`
+}
+
+// inheritRouting resolves the options of every routing destination.
+func (o *options) inheritRouting() []string {
+	problems := make([]string, 0)
+	for i, d := range o.Routing.Destinations {
+		resolved := routeDestinationFields{SLS: slsOptions{Endpoint: o.SLS.Endpoint, AccessKey: o.SLS.AccessKey, SecurityKey: o.SLS.SecurityKey}}
+		data, err := yaml.Marshal(d.raw)
+		if err == nil {
+			err = yaml.UnmarshalStrict(data, &resolved)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Routing destination %d is invalid: %v", i, err))
+		}
+		resolved.raw = d.raw
+		o.Routing.Destinations[i] = routeDestinationOptions(resolved)
+	}
+	return problems
+}
+
+// routing validates the routes and returns them with the problems found.
+func (o *routingOptions) routing() (Routing, []string) {
+	routing := Routing{Destinations: make([]Destination, 0), Routes: make([]Route, 0), Default: o.Default}
+	problems := make([]string, 0)
+
+	destinations := map[string]*Destination{DEFAULT_DESTINATION: nil}
+	for i := range o.Destinations {
+		d := &o.Destinations[i]
+		suffix := fmt.Sprintf(" of routing destination [%s]", d.Name)
+		if d.Name == "" {
+			problems = append(problems, fmt.Sprintf("Routing destination %d has no name", i))
+			continue
+		}
+		if _, ok := destinations[d.Name]; ok {
+			problems = append(problems, fmt.Sprintf("Routing destination %s is duplicated or reserved", d.Name))
+			continue
+		}
+
+		problems = append(problems, d.SLS.validateProject(suffix)...)
+		d.SLS.deriveLogstores()
+		destination := d.destination()
+		routing.Destinations = append(routing.Destinations, destination)
+		destinations[d.Name] = &destination
+	}
+
+	if len(routing.Default) == 0 {
+		routing.Default = []string{DEFAULT_DESTINATION}
+	}
+	for _, name := range routing.Default {
+		if _, ok := destinations[name]; !ok {
+			problems = append(problems, fmt.Sprintf("Unknown destination %s of the default route", name))
+		}
+	}
+
+	for i, r := range o.Routes {
+		route := Route{Types: make(map[string]bool), Instance: r.Instance, Attributes: r.Attributes, Destinations: r.Destinations}
+		for _, t := range r.Types {
+			if !isDataType(t) {
+				problems = append(problems, fmt.Sprintf("Unknown data type %s of route %d", t, i))
+			}
+			route.Types[t] = true
+		}
+
+		if r.Service != "" {
+			service, err := regexp.Compile(r.Service)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Service %s of route %d is not a valid regular expression: %v", r.Service, i, err))
+			}
+			route.Service = service
+		}
+
+		if len(r.Destinations) == 0 {
+			problems = append(problems, fmt.Sprintf("Route %d has no destination", i))
+		}
+		for _, name := range r.Destinations {
+			d, ok := destinations[name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("Unknown destination %s of route %d", name, i))
+				continue
+			}
+			// the destination of the namespaces has every logstore
+			if d == nil {
+				continue
+			}
+			for _, t := range dataTypes {
+				if (len(route.Types) == 0 || route.Types[t]) && d.Logstore(t) == "" {
+					problems = append(problems, fmt.Sprintf("Destination %s of route %d has no logstore of %s data", name, i, t))
+				}
+			}
+		}
+
+		routing.Routes = append(routing.Routes, route)
+	}
+
+	return routing, problems
+}
+
+func (d *routeDestinationOptions) destination() Destination {
+	return Destination{
+		Name:                 d.Name,
+		Endpoint:             d.SLS.Endpoint,
+		AccessKey:            d.SLS.AccessKey,
+		AccessSecurityKey:    d.SLS.SecurityKey,
+		Project:              d.SLS.Project,
+		TraceInstance:        d.SLS.TraceInstance,
+		TracesLogstore:       d.SLS.Logstores.Traces,
+		MetricsLogstore:      d.SLS.Logstores.Metrics,
+		LogsLogstore:         d.SLS.Logstores.Logs,
+		DependenciesLogstore: d.SLS.Logstores.Dependencies,
+	}
+}
@@ -0,0 +1,199 @@
+package configure
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decoders of the records read from kafka.
+const (
+	DECODER_SEGMENT           = "segment"
+	DECODER_METRIC            = "metric"
+	DECODER_LOGGING           = "logging"
+	DECODER_METER             = "meter"
+	DECODER_CLR_METRIC        = "clr-metric"
+	DECODER_PROFILING         = "profiling"
+	DECODER_BROWSER_PERF      = "browser-perf"
+	DECODER_BROWSER_ERROR_LOG = "browser-error-log"
+	DECODER_EVENT             = "event"
+)
+
+// NAMESPACE_PLACEHOLDER is replaced by the namespace in the topic templates.
+// Templates without it are prefixed by "<namespace>-" if a namespace is set.
+const NAMESPACE_PLACEHOLDER = "{namespace}"
+
+var decoders = map[string]bool{
+	DECODER_SEGMENT:           true,
+	DECODER_METRIC:            true,
+	DECODER_LOGGING:           true,
+	DECODER_METER:             true,
+	DECODER_CLR_METRIC:        true,
+	DECODER_PROFILING:         true,
+	DECODER_BROWSER_PERF:      true,
+	DECODER_BROWSER_ERROR_LOG: true,
+	DECODER_EVENT:             true,
+}
+
+// topicOptions are the templates of the topics of each decoder, the topics of
+// empty templates are not consumed.
+type topicOptions struct {
+	Segments         string `yaml:"segments"`
+	Metrics          string `yaml:"metrics"`
+	Logging          string `yaml:"logging"`
+	Meters           string `yaml:"meters"`
+	CLRMetrics       string `yaml:"clr_metrics"`
+	Profilings       string `yaml:"profilings"`
+	BrowserPerf      string `yaml:"browser_perf"`
+	BrowserErrorLogs string `yaml:"browser_error_logs"`
+	Events           string `yaml:"events"`
+	// Decoders maps extra topics to their decoders, topics starting with ^
+	// are regular expressions
+	Decoders stringMap `yaml:"decoders"`
+}
+
+func (o *topicOptions) templates() map[string]string {
+	return map[string]string{
+		DECODER_SEGMENT:           o.Segments,
+		DECODER_METRIC:            o.Metrics,
+		DECODER_LOGGING:           o.Logging,
+		DECODER_METER:             o.Meters,
+		DECODER_CLR_METRIC:        o.CLRMetrics,
+		DECODER_PROFILING:         o.Profilings,
+		DECODER_BROWSER_PERF:      o.BrowserPerf,
+		DECODER_BROWSER_ERROR_LOG: o.BrowserErrorLogs,
+		DECODER_EVENT:             o.Events,
+	}
+}
+
+// topicName renders a topic template with the namespace.
+func topicName(template string, namespace string) string {
+	if template == "" {
+		return ""
+	}
+	if strings.Contains(template, NAMESPACE_PLACEHOLDER) {
+		return strings.ReplaceAll(template, NAMESPACE_PLACEHOLDER, namespace)
+	}
+	if namespace == "" {
+		return template
+	}
+	return fmt.Sprintf("%s-%s", namespace, template)
+}
+
+// topicRoute is the decoder and the namespace of the records of a topic.
+type topicRoute struct {
+	decoder   string
+	namespace string
+}
+
+type topicPattern struct {
+	pattern *regexp.Regexp
+	route   topicRoute
+}
+
+// topicResolver finds the route of a topic, exact names are matched before
+// the regular expressions, which are matched in lexical order.
+type topicResolver struct {
+	// topics are subscribed, including the regular expressions
+	topics []string
+	// names maps the decoders to the topics rendered from the templates of
+	// the first namespace
+	names    map[string]string
+	routes   map[string]topicRoute
+	patterns []topicPattern
+	// cache of the topics matched against the patterns
+	cache sync.Map
+}
+
+func newTopicResolver(namespaces []namespaceOptions) (*topicResolver, []string) {
+	r := &topicResolver{
+		topics:   make([]string, 0),
+		names:    make(map[string]string),
+		routes:   make(map[string]topicRoute),
+		patterns: make([]topicPattern, 0),
+	}
+	problems := make([]string, 0)
+
+	for i, n := range namespaces {
+		templates := n.Topics.templates()
+		for _, decoder := range []string{DECODER_SEGMENT, DECODER_METRIC, DECODER_LOGGING, DECODER_METER, DECODER_CLR_METRIC,
+			DECODER_PROFILING, DECODER_BROWSER_PERF, DECODER_BROWSER_ERROR_LOG, DECODER_EVENT} {
+			name := topicName(templates[decoder], n.Name)
+			if i == 0 {
+				r.names[decoder] = name
+			}
+			if name == "" {
+				continue
+			}
+			if route, ok := r.routes[name]; ok {
+				problems = append(problems, fmt.Sprintf("Topic %s is used by both %s of namespace [%s] and %s of namespace [%s]",
+					name, route.decoder, route.namespace, decoder, n.Name))
+				continue
+			}
+			r.routes[name] = topicRoute{decoder: decoder, namespace: n.Name}
+			r.topics = append(r.topics, name)
+		}
+	}
+
+	for _, n := range namespaces {
+		problems = append(problems, r.addDecoders(n)...)
+	}
+
+	return r, problems
+}
+
+// addDecoders routes the extra topics of a namespace.
+func (r *topicResolver) addDecoders(n namespaceOptions) []string {
+	problems := make([]string, 0)
+	topics := make([]string, 0, len(n.Topics.Decoders))
+	for topic := range n.Topics.Decoders {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		route := topicRoute{decoder: n.Topics.Decoders[topic], namespace: n.Name}
+		if !decoders[route.decoder] {
+			problems = append(problems, fmt.Sprintf("Unknown decoder %s of topic %s", route.decoder, topic))
+			continue
+		}
+		if !strings.HasPrefix(topic, "^") {
+			if _, ok := r.routes[topic]; !ok {
+				r.topics = append(r.topics, topic)
+			}
+			r.routes[topic] = route
+			continue
+		}
+		pattern, err := regexp.Compile(topic)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Topic %s is not a valid regular expression: %v", topic, err))
+			continue
+		}
+		r.patterns = append(r.patterns, topicPattern{pattern: pattern, route: route})
+		r.topics = append(r.topics, topic)
+	}
+	return problems
+}
+
+// route returns the route of the topic, the decoder is empty if the topic is
+// unknown.
+func (r *topicResolver) route(topic string) topicRoute {
+	if route, ok := r.routes[topic]; ok {
+		return route
+	}
+	if route, ok := r.cache.Load(topic); ok {
+		return route.(topicRoute)
+	}
+
+	route := topicRoute{}
+	for _, p := range r.patterns {
+		if p.pattern.MatchString(topic) {
+			route = p.route
+			break
+		}
+	}
+	r.cache.Store(topic, route)
+	return route
+}
@@ -0,0 +1,249 @@
+package configure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError reports every problem of a configuration at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// validate fills the empty options with their defaults and returns the
+// problems found.
+func (o *options) validate() []string {
+	problems := make([]string, 0)
+	problem := func(a ...interface{}) {
+		problems = append(problems, strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+	}
+	defaults := defaultOptions()
+
+	if len(o.Namespaces) == 0 {
+		problems = append(problems, o.SLS.validate("")...)
+	}
+
+	names := make(map[string]bool)
+	for i := range o.Namespaces {
+		n := &o.Namespaces[i]
+		if names[n.Name] {
+			problem("Namespace", n.Name, "is duplicated")
+		}
+		names[n.Name] = true
+		problems = append(problems, n.SLS.validate(fmt.Sprintf(" of namespace [%s]", n.Name))...)
+	}
+
+	if o.Receiver.Type == "" {
+		o.Receiver.Type = KAFKA_RECEIVER
+	}
+
+	if o.Receiver.Type != KAFKA_RECEIVER && o.Receiver.Type != GRPC_RECEIVER {
+		problem("Unknown receiver type", o.Receiver.Type)
+	}
+
+	if o.Receiver.Type == KAFKA_RECEIVER && o.Kafka.BootstrapServers == "" {
+		problem("Miss parameter [bootstrap servers]")
+	}
+
+	if o.Receiver.GRPCAddress == "" {
+		o.Receiver.GRPCAddress = defaults.Receiver.GRPCAddress
+	}
+
+	if o.Pipeline.BatchMaxLogs <= 0 || o.Pipeline.BatchMaxLogs > MAX_BATCH_LOGS {
+		problem("Parameter [batch max logs] should be between 1 and", MAX_BATCH_LOGS)
+	}
+
+	if o.Pipeline.BatchMaxBytes <= 0 || o.Pipeline.BatchMaxBytes >= MAX_BATCH_BYTES {
+		problem("Parameter [batch max bytes] should be positive and less than", MAX_BATCH_BYTES)
+	}
+
+	if o.Pipeline.BatchLinger <= 0 {
+		problem("Parameter [batch linger] should be positive")
+	}
+
+	if o.MetricsAddress == "" {
+		o.MetricsAddress = defaults.MetricsAddress
+	}
+
+	if o.Log.Level == "" {
+		o.Log.Level = defaults.Log.Level
+	}
+
+	if o.Log.Format == "" {
+		o.Log.Format = defaults.Log.Format
+	}
+
+	if o.Log.Format != "console" && o.Log.Format != "json" {
+		problem("Parameter [log format] should be console or json")
+	}
+
+	switch o.DeadLetter.Type {
+	case "":
+		if o.DeadLetter.Replay {
+			problem("Miss parameter [dead letter] to replay")
+		}
+	case KAFKA_DEAD_LETTER:
+		if o.Kafka.BootstrapServers == "" {
+			problem("Miss parameter [bootstrap servers] of dead letter topic")
+		}
+		if o.DeadLetter.Topic == "" {
+			o.DeadLetter.Topic = defaults.DeadLetter.Topic
+		}
+	case FILE_DEAD_LETTER:
+		if o.DeadLetter.Directory == "" {
+			problem("Miss parameter [dead letter dir]")
+		}
+	default:
+		problem("Unknown dead letter type", o.DeadLetter.Type)
+	}
+
+	if o.Pipeline.ExportMaxRetries < 0 {
+		problem("Parameter [export max retries] should not be negative")
+	}
+
+	// Data given up without a sink would block the offsets of its partition
+	// until the next restart.
+	if o.Pipeline.ExportMaxRetries > 0 && o.DeadLetter.Type == "" {
+		problem("Parameter [export max retries] requires [dead letter]")
+	}
+
+	if o.Converter.IDEncoding == "" {
+		o.Converter.IDEncoding = ID_ENCODING_SKYWALKING
+	}
+
+	if o.Converter.IDEncoding != ID_ENCODING_SKYWALKING && o.Converter.IDEncoding != ID_ENCODING_OTEL {
+		problem("Unknown id encoding", o.Converter.IDEncoding)
+	}
+
+	if o.Converter.StatusCodes == "" {
+		o.Converter.StatusCodes = STATUS_CODES_SKYWALKING
+	}
+
+	if o.Converter.StatusCodes != STATUS_CODES_SKYWALKING && o.Converter.StatusCodes != STATUS_CODES_OTEL {
+		problem("Unknown status codes", o.Converter.StatusCodes)
+	}
+
+	if o.Converter.DependencyWindow < 0 {
+		problem("Parameter [dependency window] should not be negative")
+	}
+
+	if len(o.Converter.RED.Buckets) == 0 {
+		o.Converter.RED.Buckets = defaults.Converter.RED.Buckets
+	}
+
+	for i := 1; i < len(o.Converter.RED.Buckets); i++ {
+		if o.Converter.RED.Buckets[i] <= o.Converter.RED.Buckets[i-1] {
+			problem(fmt.Sprintf("Parameter [red buckets] is invalid: bucket %v is not in ascending order", o.Converter.RED.Buckets[i]))
+			break
+		}
+	}
+
+	if o.Converter.RED.MaxEndpoints < 0 {
+		problem("Parameter [red max endpoints] should not be negative")
+	}
+
+	if o.Sampling.Fallback == "" {
+		o.Sampling.Fallback = SAMPLING_FALLBACK_KEEP
+	}
+
+	if o.Sampling.Fallback != SAMPLING_FALLBACK_KEEP && o.Sampling.Fallback != SAMPLING_FALLBACK_DROP {
+		problem("Unknown sampling fallback", o.Sampling.Fallback)
+	}
+
+	services := make([]string, 0, len(o.Sampling.ServiceProbabilities))
+	for service, probability := range o.Sampling.ServiceProbabilities {
+		if probability < 0 || probability > 1 {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		problem(fmt.Sprintf("Parameter [sampling service probabilities] is invalid: probability of %s should be between 0 and 1", service))
+	}
+
+	if o.Sampling.Probability < 0 || o.Sampling.Probability > 1 {
+		problem("Parameter [sampling probability] should be between 0 and 1")
+	}
+
+	if o.Sampling.DecisionWait <= 0 || o.Sampling.MaxSpans <= 0 {
+		problem("Parameter [sampling decision wait] and [sampling max spans] should be positive")
+	}
+
+	if o.Sampling.LatencyThreshold < 0 || o.Sampling.EndpointRateLimit < 0 {
+		problem("Parameter [sampling latency threshold] and [sampling endpoint rate limit] should not be negative")
+	}
+
+	if o.Pipeline.ConvertWorkers <= 0 || o.Pipeline.ExportWorkers <= 0 || o.Pipeline.QueueSize <= 0 {
+		problem("Parameter [convert workers], [export workers] and [queue size] should be positive")
+	}
+
+	if o.Kafka.GroupID == "" {
+		o.Kafka.GroupID = defaults.Kafka.GroupID
+	}
+
+	return problems
+}
+
+// validate fills the empty logstores and returns the problems of a
+// destination, the suffix tells the namespace of the destination.
+func (o *slsOptions) validate(suffix string) []string {
+	problems := o.validateProject(suffix)
+
+	if o.TraceInstance == "" {
+		problems = append(problems, "Miss parameter [trace instace]"+suffix)
+	}
+
+	o.deriveLogstores()
+	return problems
+}
+
+// validateProject returns the problems of the project and its credentials.
+func (o *slsOptions) validateProject(suffix string) []string {
+	problems := make([]string, 0)
+
+	if o.Endpoint == "" {
+		problems = append(problems, "Miss Parameter [endpoint]"+suffix)
+	}
+
+	if o.AccessKey == "" {
+		problems = append(problems, "Miss parameter [access key]"+suffix)
+	}
+
+	if o.SecurityKey == "" {
+		problems = append(problems, "Miss parameter [access security key]"+suffix)
+	}
+
+	if o.Project == "" {
+		problems = append(problems, "Miss parameter [project]"+suffix)
+	}
+
+	return problems
+}
+
+// deriveLogstores fills the empty logstores from the trace instance.
+func (o *slsOptions) deriveLogstores() {
+	if o.TraceInstance == "" {
+		return
+	}
+
+	if o.Logstores.Traces == "" {
+		o.Logstores.Traces = fmt.Sprintf("%s-traces", o.TraceInstance)
+	}
+
+	if o.Logstores.Metrics == "" {
+		o.Logstores.Metrics = fmt.Sprintf("%s-metrics", o.TraceInstance)
+	}
+
+	if o.Logstores.Logs == "" {
+		o.Logstores.Logs = fmt.Sprintf("%s-logs", o.TraceInstance)
+	}
+
+	if o.Logstores.Dependencies == "" {
+		o.Logstores.Dependencies = fmt.Sprintf("%s-dependencies", o.TraceInstance)
+	}
+}
@@ -0,0 +1,113 @@
+package converter
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// tagMapping describes how a SkyWalking tag is translated into an
+// OpenTelemetry semantic convention attribute.
+type tagMapping struct {
+	// key the OpenTelemetry attribute key
+	key string
+	// value converts the tag value, the value is kept as is if nil
+	value func(string) string
+	// extra attributes implied by the tag
+	extra map[string]string
+}
+
+// tagMapper rewrites span tags with the OpenTelemetry semantic conventions.
+type tagMapper struct {
+	keepOriginal bool
+}
+
+// mapAttribute returns the attribute with the OpenTelemetry attributes of the
+// SkyWalking tags added. Attributes already reported by the agent are never
+// overwritten, and the tags are mapped in the order of their keys so that tags
+// mapped to the same attribute always give the same result.
+func (m *tagMapper) mapAttribute(attribute map[string]string) map[string]string {
+	keys := make([]string, 0, len(attribute))
+	for key := range attribute {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mapped := make(map[string]string, len(attribute))
+	setIfAbsent := func(k, v string) {
+		if _, exists := attribute[k]; exists {
+			return
+		}
+		if _, exists := mapped[k]; !exists {
+			mapped[k] = v
+		}
+	}
+
+	for _, key := range keys {
+		value := attribute[key]
+		mapping, ok := otSpanTagsMapping[key]
+		if !ok {
+			mapped[key] = value
+			continue
+		}
+
+		if m.keepOriginal {
+			mapped[key] = value
+		}
+		if mapping.value != nil {
+			value = mapping.value(value)
+		}
+		if mapping.key == key {
+			mapped[key] = value
+		} else {
+			setIfAbsent(mapping.key, value)
+		}
+		for k, v := range mapping.extra {
+			setIfAbsent(k, v)
+		}
+	}
+	return mapped
+}
+
+// mapPeer derives the net.peer.* attributes from the peer of an exit span,
+// which is reported as host, host:port or a comma separated cluster address.
+func (m *tagMapper) mapPeer(attribute map[string]string, peer string) {
+	if peer == "" {
+		return
+	}
+
+	host, port := peer, ""
+	if !strings.Contains(peer, ",") {
+		if h, p, err := net.SplitHostPort(peer); err == nil {
+			host, port = h, p
+		}
+	}
+
+	setIfAbsent := func(k, v string) {
+		if _, exists := attribute[k]; !exists && v != "" {
+			attribute[k] = v
+		}
+	}
+
+	if net.ParseIP(host) != nil {
+		setIfAbsent(AttributeNetPeerIP, host)
+	} else {
+		setIfAbsent(AttributeNetPeerName, host)
+	}
+	setIfAbsent(AttributeNetPeerPort, port)
+}
+
+// dbSystem converts SkyWalking database types such as Mysql or Redis into the
+// lower case identifiers of db.system.
+func dbSystem(dbType string) string {
+	switch system := strings.ToLower(dbType); system {
+	case "sql":
+		return "other_sql"
+	case "mongo":
+		return "mongodb"
+	case "postgresql":
+		return "postgresql"
+	default:
+		return system
+	}
+}
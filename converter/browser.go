@@ -0,0 +1,104 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+)
+
+// browserLayer is the layer of the logs converted from browser error logs.
+const browserLayer = "BROWSER"
+
+func (c *convertImpl) convertBrowserPerf(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting browser perf data", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert browser perf data")
+		}
+	}()
+
+	perf := &agentV3.BrowserPerfData{}
+	if e = proto.Unmarshal(data, perf); e != nil {
+		return nil, modules.METRIC, e
+	}
+
+	serviceName := newPair("service", perf.GetService())
+	serviceVersion := newPair("serviceVersion", perf.GetServiceVersion())
+	pagePath := newPair("pagePath", perf.GetPagePath())
+
+	logs := make([]*sls.Log, 0)
+	for _, m := range []struct {
+		name  string
+		value int32
+	}{
+		{"skywalking_browser_redirect_time_ms", perf.GetRedirectTime()},
+		{"skywalking_browser_dns_time_ms", perf.GetDnsTime()},
+		{"skywalking_browser_ttfb_time_ms", perf.GetTtfbTime()},
+		{"skywalking_browser_tcp_time_ms", perf.GetTcpTime()},
+		{"skywalking_browser_trans_time_ms", perf.GetTransTime()},
+		{"skywalking_browser_dom_analysis_time_ms", perf.GetDomAnalysisTime()},
+		{"skywalking_browser_fpt_time_ms", perf.GetFptTime()},
+		{"skywalking_browser_dom_ready_time_ms", perf.GetDomReadyTime()},
+		{"skywalking_browser_load_page_time_ms", perf.GetLoadPageTime()},
+		{"skywalking_browser_res_time_ms", perf.GetResTime()},
+		{"skywalking_browser_ssl_time_ms", perf.GetSslTime()},
+		{"skywalking_browser_ttl_time_ms", perf.GetTtlTime()},
+		{"skywalking_browser_first_pack_time_ms", perf.GetFirstPackTime()},
+		{"skywalking_browser_fmp_time_ms", perf.GetFmpTime()},
+	} {
+		logs = append(logs, newMetric(m.name, perf.GetTime(), strconv.FormatInt(int64(m.value), 10), serviceName, serviceVersion, pagePath))
+	}
+
+	return &sls.LogGroup{
+		Source: proto.String("0.0.0.0"),
+		Logs:   logs,
+	}, modules.METRIC, nil
+}
+
+// convertBrowserErrorLog converts a browser error log to a log, the service
+// version and the page path are taken as the service instance and the endpoint.
+func (c *convertImpl) convertBrowserErrorLog(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting browser error log", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert browser error log")
+		}
+	}()
+
+	errorLog := &agentV3.BrowserErrorLog{}
+	if e = proto.Unmarshal(data, errorLog); e != nil {
+		return nil, modules.LOGGING, e
+	}
+
+	body := errorLog.GetMessage()
+	if errorLog.GetStack() != "" {
+		body = body + "\n" + errorLog.GetStack()
+	}
+
+	return c.convertLogData(&loggingV3.LogData{
+		Timestamp:       errorLog.GetTime(),
+		Service:         errorLog.GetService(),
+		ServiceInstance: errorLog.GetServiceVersion(),
+		Endpoint:        errorLog.GetPagePath(),
+		Body: &loggingV3.LogDataBody{
+			Content: &loggingV3.LogDataBody_Text{Text: &loggingV3.TextLog{Text: body}},
+		},
+		Tags: &loggingV3.LogTags{Data: []*v3.KeyStringValuePair{
+			{Key: "uniqueId", Value: errorLog.GetUniqueId()},
+			{Key: "category", Value: errorLog.GetCategory().String()},
+			{Key: "grade", Value: errorLog.GetGrade()},
+			{Key: "errorUrl", Value: errorLog.GetErrorUrl()},
+			{Key: "line", Value: strconv.Itoa(int(errorLog.GetLine()))},
+			{Key: "col", Value: strconv.Itoa(int(errorLog.GetCol()))},
+			{Key: "firstReportedError", Value: strconv.FormatBool(errorLog.GetFirstReportedError())},
+		}},
+		Layer: browserLayer,
+	})
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// convertCLRMetric converts the metrics of .NET agents. They are only received
+// on the CLR metric topics, the payloads can't be told from the JVM metrics of
+// the shared metric topic.
+func (c *convertImpl) convertCLRMetric(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting CLR metric", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert CLR metric")
+		}
+	}()
+
+	clrMetric := &agentV3.CLRMetricCollection{}
+	if e = proto.Unmarshal(data, clrMetric); e != nil {
+		return nil, modules.METRIC, e
+	}
+
+	if len(clrMetric.Metrics) == 0 {
+		return nil, modules.METRIC, nil
+	}
+
+	logs := make([]*sls.Log, 0)
+
+	for _, metric := range clrMetric.Metrics {
+		logs = c.convertCLRCPU(clrMetric, metric, metric.GetCpu(), logs)
+		logs = c.convertCLRGC(clrMetric, metric, metric.GetGc(), logs)
+		logs = c.convertCLRThread(clrMetric, metric, metric.GetThread(), logs)
+	}
+	return &sls.LogGroup{
+		Source: proto.String("0.0.0.0"),
+		Logs:   logs,
+	}, modules.METRIC, nil
+}
+
+func (c *convertImpl) convertCLRCPU(clrMetric *agentV3.CLRMetricCollection, metric *agentV3.CLRMetric, cpu *v3.CPU, logs []*sls.Log) []*sls.Log {
+	if cpu == nil {
+		return logs
+	}
+
+	serviceName := newPair("service", clrMetric.GetService())
+	serviceInstance := newPair("serviceInstance", clrMetric.GetServiceInstance())
+	logs = append(logs, newMetric("skywalking_clr_cpu_usage", metric.GetTime(), strconv.FormatFloat(cpu.GetUsagePercent(), 'f', 6, 64), serviceName, serviceInstance))
+	return logs
+}
+
+func (c *convertImpl) convertCLRGC(clrMetric *agentV3.CLRMetricCollection, metric *agentV3.CLRMetric, gc *agentV3.ClrGC, logs []*sls.Log) []*sls.Log {
+	if gc == nil {
+		return logs
+	}
+
+	serviceName := newPair("service", clrMetric.GetService())
+	serviceInstance := newPair("serviceInstance", clrMetric.GetServiceInstance())
+
+	logs = append(logs, newMetric("skywalking_clr_gc_count", metric.GetTime(), strconv.FormatInt(gc.GetGen0CollectCount(), 10), newPair("generation", "gen0"), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_gc_count", metric.GetTime(), strconv.FormatInt(gc.GetGen1CollectCount(), 10), newPair("generation", "gen1"), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_gc_count", metric.GetTime(), strconv.FormatInt(gc.GetGen2CollectCount(), 10), newPair("generation", "gen2"), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_heap_memory", metric.GetTime(), strconv.FormatInt(gc.GetHeapMemory(), 10), serviceName, serviceInstance))
+	return logs
+}
+
+func (c *convertImpl) convertCLRThread(clrMetric *agentV3.CLRMetricCollection, metric *agentV3.CLRMetric, thread *agentV3.ClrThread, logs []*sls.Log) []*sls.Log {
+	if thread == nil {
+		return logs
+	}
+
+	serviceName := newPair("service", clrMetric.GetService())
+	serviceInstance := newPair("serviceInstance", clrMetric.GetServiceInstance())
+
+	logs = append(logs, newMetric("skywalking_clr_threads_available_completion_port", metric.GetTime(), strconv.FormatInt(int64(thread.GetAvailableCompletionPortThreads()), 10), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_threads_available_worker", metric.GetTime(), strconv.FormatInt(int64(thread.GetAvailableWorkerThreads()), 10), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_threads_max_completion_port", metric.GetTime(), strconv.FormatInt(int64(thread.GetMaxCompletionPortThreads()), 10), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_clr_threads_max_worker", metric.GetTime(), strconv.FormatInt(int64(thread.GetMaxWorkerThreads()), 10), serviceName, serviceInstance))
+	return logs
+}
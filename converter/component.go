@@ -0,0 +1,66 @@
+package converter
+
+import (
+	_ "embed"
+	"io/ioutil"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed component-libraries.yml
+var defaultComponentLibraries []byte
+
+type componentLibrary struct {
+	ID *int32 `yaml:"id"`
+}
+
+// componentLibraries maps the component ids reported by the agents to the
+// names of the libraries.
+type componentLibraries map[int32]string
+
+// newComponentLibraries loads the built-in component libraries, and overrides
+// them with the libraries of the file if one is given.
+func newComponentLibraries(file string) (componentLibraries, error) {
+	libraries := make(componentLibraries)
+	if err := libraries.load(defaultComponentLibraries); err != nil {
+		return nil, err
+	}
+
+	if file == "" {
+		return libraries, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = libraries.load(data); err != nil {
+		return nil, err
+	}
+	return libraries, nil
+}
+
+func (l componentLibraries) load(data []byte) error {
+	definitions := make(map[string]componentLibrary)
+	if err := yaml.Unmarshal(data, &definitions); err != nil {
+		return err
+	}
+
+	for name, definition := range definitions {
+		// Sections such as Component-Server-Mappings have no id.
+		if definition.ID == nil {
+			continue
+		}
+		l[*definition.ID] = name
+	}
+	return nil
+}
+
+// name returns the library of the component, or the id itself if it is unknown.
+func (l componentLibraries) name(id int32) string {
+	if name, ok := l[id]; ok {
+		return name
+	}
+	return strconv.Itoa(int(id))
+}
@@ -47,6 +47,25 @@ const (
 	StatusCode = "statusCode"
 	// StatusCodeField
 	StatusCodeField = "statuscode"
+	// StatusCodeError the status code of failed spans
+	StatusCodeError = "ERROR"
+)
+
+const (
+	// AttributeSkyWalkingTraceID the attribute of the original SkyWalking trace id
+	AttributeSkyWalkingTraceID = "sw.trace_id"
+	// AttributeSkyWalkingSegmentID the attribute of the original SkyWalking segment id
+	AttributeSkyWalkingSegmentID = "sw.segment_id"
+	// AttributeSkyWalkingSpanID the attribute of the original SkyWalking span id
+	AttributeSkyWalkingSpanID = "sw.span_id"
+	// AttributeComponent the attribute of the library which created the span
+	AttributeComponent = "component"
+	// AttributeLayer the attribute of the SkyWalking span layer
+	AttributeLayer = "layer"
+	// AttributePeer the attribute of the remote address of exit spans
+	AttributePeer = "peer"
+	// AttributeSkipAnalysis the attribute of whether the OAP skips analysing the span
+	AttributeSkipAnalysis = "skip_analysis"
 )
 
 const (
@@ -57,10 +76,75 @@ const (
 	AttributeNetworkAddressUsedAtPeer = "network.AddressUsedAtPeer"
 )
 
-var otSpanTagsMapping = map[string]string{
-	"url":         "",
-	"status_code": "http.status_code",
-	"db.type":     "db.system",
-	"db.instance": "",
-	"mq.broker":   "",
+const (
+	// AttributeNetPeerName the attribute of the remote host name
+	AttributeNetPeerName = "net.peer.name"
+	// AttributeNetPeerIP the attribute of the remote address
+	AttributeNetPeerIP = "net.peer.ip"
+	// AttributeNetPeerPort the attribute of the remote port
+	AttributeNetPeerPort = "net.peer.port"
+)
+
+// otSpanTagsMapping maps the standard SkyWalking tags to the OpenTelemetry
+// semantic conventions. cache.op and cache.key have no counterpart and are kept.
+var otSpanTagsMapping = map[string]tagMapping{
+	"http.method":      {key: "http.method"},
+	"url":              {key: "http.url"},
+	"status_code":      {key: "http.status_code"},
+	"http.status_code": {key: "http.status_code"},
+	"db.type":          {key: "db.system", value: dbSystem},
+	"db.instance":      {key: "db.name"},
+	"db.statement":     {key: "db.statement"},
+	"mq.queue":         {key: "messaging.destination", extra: map[string]string{"messaging.destination_kind": "queue"}},
+	"mq.topic":         {key: "messaging.destination", extra: map[string]string{"messaging.destination_kind": "topic"}},
+	"mq.broker":        {key: "messaging.url"},
+	"cache.type":       {key: "db.system", value: dbSystem},
+	"cache.cmd":        {key: "db.operation"},
 }
+
+const (
+	// LogTimestamp the field name of log timestamp
+	LogTimestamp = "timestamp"
+	// LogServiceInstance the field name of service instance
+	LogServiceInstance = "serviceInstance"
+	// LogEndpoint the field name of endpoint
+	LogEndpoint = "endpoint"
+	// LogSegmentID the field name of trace segment id
+	LogSegmentID = "segmentID"
+	// LogContent the field name of log body
+	LogContent = "content"
+	// LogContentType the field name of log body type, one of text/json/yaml
+	LogContentType = "contentType"
+	// LogTags the field name of log tags
+	LogTags = "tags"
+	// LogLayer the field name of service layer
+	LogLayer = "layer"
+)
+
+const (
+	// DependencyEndpoint the field name of the endpoint called by the parent service
+	DependencyEndpoint = "endpoint"
+	// DependencyWindow the field name of the length of the window in seconds
+	DependencyWindow = "window"
+	// DependencyCalls the field name of the number of calls
+	DependencyCalls = "calls"
+	// DependencyErrors the field name of the number of failed calls
+	DependencyErrors = "errors"
+	// DependencyLatencySum the field name of the sum of the call durations in microseconds
+	DependencyLatencySum = "latency_sum"
+)
+
+const (
+	// SpanLogEvent the key of the event of span logs
+	SpanLogEvent = "event"
+	// SpanLogErrorKind the key of the exception class of error span logs
+	SpanLogErrorKind = "error.kind"
+	// SpanLogMessage the key of the exception message of error span logs
+	SpanLogMessage = "message"
+	// SpanLogStack the key of the stack trace of error span logs
+	SpanLogStack = "stack"
+	// LogSkyWalkingTraceID the field name of the original SkyWalking trace id
+	LogSkyWalkingTraceID = "swTraceID"
+	// LogSkyWalkingSpanID the field name of the original SkyWalking span id
+	LogSkyWalkingSpanID = "swSpanID"
+)
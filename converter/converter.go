@@ -5,41 +5,113 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aliyun-sls/skywalking-ingester/configure"
 	"github.com/aliyun-sls/skywalking-ingester/modules"
 	sls "github.com/aliyun/aliyun-log-go-sdk"
 	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
 	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
 	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
 )
 
 type Converter interface {
 	Convert(modules.OriginData) (*sls.LogGroup, modules.DataType, error)
+	// Aggregators returns the aggregators fed by Convert, which have to be
+	// flushed periodically.
+	Aggregators() []Aggregator
 }
 
-func NewConverter() Converter {
-	return &convertImpl{}
+func NewConverter(config configure.Configuration, logger *zap.Logger) (Converter, error) {
+	components, err := newComponentLibraries(config.ComponentLibraries())
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := newRedactor(config.RedactionRules())
+	if err != nil {
+		return nil, err
+	}
+
+	c := &convertImpl{
+		logger:      logger,
+		ids:         newIDEncoder(config),
+		tags:        &tagMapper{keepOriginal: config.KeepOriginalTags()},
+		components:  components,
+		statusCodes: newStatusCodes(config),
+		redactor:    redactor,
+	}
+	if config.DependencyWindow() > 0 {
+		c.dependencies = newDependencyAggregator(config.DependencyWindow())
+	}
+	if config.REDMetrics() {
+		c.red = newREDAggregator(c.statusCodes, config.REDBuckets(), config.REDMaxEndpoints())
+	}
+	return c, nil
 }
 
 type convertImpl struct {
+	logger      *zap.Logger
+	ids         idEncoder
+	tags        *tagMapper
+	components  componentLibraries
+	statusCodes *statusCodes
+	// redactor is nil if no redaction rules are configured
+	redactor *redactor
+	// dependencies is nil if dependency extraction is disabled
+	dependencies *dependencyAggregator
+	// red is nil if RED metrics are disabled
+	red *redAggregator
+}
+
+func (c *convertImpl) Aggregators() []Aggregator {
+	aggregators := make([]Aggregator, 0)
+	if c.dependencies != nil {
+		aggregators = append(aggregators, c.dependencies)
+	}
+	if c.red != nil {
+		aggregators = append(aggregators, c.red)
+	}
+	return aggregators
 }
 
+// Convert tags the converted data with the namespace of its origin.
 func (c *convertImpl) Convert(data modules.OriginData) (*sls.LogGroup, modules.DataType, error) {
 	if data == nil {
 		return nil, modules.NOOP, nil
 	}
 
+	group, t, err := c.convert(data)
+	modules.SetNamespace(group, data.Metadata().Namespace)
+	return group, t, err
+}
+
+func (c *convertImpl) convert(data modules.OriginData) (*sls.LogGroup, modules.DataType, error) {
 	switch data.(type) {
 	case *modules.SegmentOriginData:
 		if segment, err := c.convertSegmentObject(data.Data()); err != nil {
 			return nil, modules.TRACE, err
 		} else {
-			return c.convertSegment(segment)
+			return c.convertSegment(data.Metadata().Namespace, segment)
 		}
 	case *modules.MetricOriginData:
 		return c.convertMetric(data.Data())
+	case *modules.MeterOriginData:
+		return c.convertMeter(data.Data())
+	case *modules.CLRMetricOriginData:
+		return c.convertCLRMetric(data.Data())
 	case *modules.LogggingOriginData:
 		return c.convertLogging(data.Data())
+	case *modules.ProfilingOriginData:
+		return c.convertProfiling(data.Data())
+	case *modules.BrowserPerfOriginData:
+		return c.convertBrowserPerf(data.Data())
+	case *modules.BrowserErrorLogOriginData:
+		return c.convertBrowserErrorLog(data.Data())
+	case *modules.EventOriginData:
+		return c.convertEvent(data.Data())
 	default:
 		return nil, modules.NOOP, nil
 	}
@@ -48,6 +120,7 @@ func (c *convertImpl) Convert(data modules.OriginData) (*sls.LogGroup, modules.D
 func (c *convertImpl) convertSegmentObject(data []byte) (segmentObject *agentV3.SegmentObject, e error) {
 	defer func() {
 		if r := recover(); r != nil {
+			c.logger.Debug("Recovered from parsing segment object", zap.Any("panic", r))
 			e = fmt.Errorf("Parse segement object failed")
 		}
 	}()
@@ -59,7 +132,7 @@ func (c *convertImpl) convertSegmentObject(data []byte) (segmentObject *agentV3.
 	return segmentObject, nil
 }
 
-func (c *convertImpl) convertSegment(data *agentV3.SegmentObject) (*sls.LogGroup, DataType, error) {
+func (c *convertImpl) convertSegment(namespace string, data *agentV3.SegmentObject) (*sls.LogGroup, modules.DataType, error) {
 	if data == nil || len(data.Spans) == 0 {
 		return nil, modules.TRACE, nil
 	}
@@ -70,9 +143,19 @@ func (c *convertImpl) convertSegment(data *agentV3.SegmentObject) (*sls.LogGroup
 	}
 
 	for _, span := range data.Spans {
-		if log, err := spanToLog(data, span); err == nil {
+		if c.redactor != nil {
+			c.redactor.redactSpan(data.GetService(), span)
+		}
+		if c.dependencies != nil {
+			c.dependencies.record(namespace, data, span)
+		}
+		if c.red != nil {
+			c.red.record(namespace, data, span)
+		}
+		if log, err := c.spanToLog(data, span); err == nil {
 			slsData.Logs = append(slsData.Logs, log)
 		} else {
+			c.logger.Debug("Skip span", zap.String("service", data.GetService()), zap.Int32("spanId", span.GetSpanId()), zap.Error(err))
 			continue
 		}
 	}
@@ -80,15 +163,15 @@ func (c *convertImpl) convertSegment(data *agentV3.SegmentObject) (*sls.LogGroup
 	return slsData, modules.TRACE, nil
 }
 
-func spanToLog(data *agentV3.SegmentObject, span *agentV3.SpanObject) (*sls.Log, error) {
+func (c *convertImpl) spanToLog(data *agentV3.SegmentObject, span *agentV3.SpanObject) (*sls.Log, error) {
 	contents := make([]*sls.LogContent, 0)
 
 	// trace id
-	contents = append(contents, appendAttributeToLogContent(TraceIDField, data.GetTraceId()))
+	contents = append(contents, appendAttributeToLogContent(TraceIDField, c.ids.TraceID(data.GetTraceId())))
 	// span id
-	contents = append(contents, appendAttributeToLogContent(SpanIDField, convertToOtelSpanID(data.GetTraceSegmentId(), span.GetSpanId())))
+	contents = append(contents, appendAttributeToLogContent(SpanIDField, c.ids.SpanID(data.GetTraceSegmentId(), span.GetSpanId())))
 	// parent span id
-	contents = append(contents, appendAttributeToLogContent(ParentSpanID, getParentSpanId(data, span)))
+	contents = append(contents, appendAttributeToLogContent(ParentSpanID, getParentSpanId(c.ids, data, span)))
 	// name
 	contents = append(contents, appendAttributeToLogContent(OperationName, span.OperationName))
 	// start time
@@ -100,17 +183,18 @@ func spanToLog(data *agentV3.SegmentObject, span *agentV3.SpanObject) (*sls.Log,
 	// service
 	contents = append(contents, appendAttributeToLogContent(ServiceName, data.GetService()))
 	// attribute
-	contents = append(contents, appendAttributeToLogContent(Attribute, getAttribute(data, span)))
+	contents = append(contents, appendAttributeToLogContent(Attribute, c.getAttribute(data, span)))
 	// resource
 	contents = append(contents, appendAttributeToLogContent(Resource, getResource(data)))
 	// links
-	contents = append(contents, appendAttributeToLogContent(Links, getLinks(span)))
+	contents = append(contents, appendAttributeToLogContent(Links, getLinks(c.ids, span)))
 	// logs
 	contents = append(contents, appendAttributeToLogContent(Logs, getLogs(span)))
+	statusCode, statusMessage := c.statusCodes.status(span)
 	// status message
-	contents = append(contents, appendAttributeToLogContent(StatusMessageField, ""))
+	contents = append(contents, appendAttributeToLogContent(StatusMessageField, statusMessage))
 	// status code
-	contents = append(contents, appendAttributeToLogContent(StatusCodeField, getStatusCode(span)))
+	contents = append(contents, appendAttributeToLogContent(StatusCodeField, statusCode))
 	// span kind
 	contents = append(contents, appendAttributeToLogContent(SpanKind, getSpanKind(span)))
 
@@ -120,18 +204,18 @@ func spanToLog(data *agentV3.SegmentObject, span *agentV3.SpanObject) (*sls.Log,
 	}, nil
 }
 
-func getParentSpanId(data *agentV3.SegmentObject, span *agentV3.SpanObject) string {
+func getParentSpanId(ids idEncoder, data *agentV3.SegmentObject, span *agentV3.SpanObject) string {
 	if span.GetParentSpanId() == -1 && len(span.Refs) == 0 {
 		return ""
 	} else if len(span.Refs) > 0 {
 		ref := span.Refs[0]
-		return convertToOtelSpanID(ref.ParentTraceSegmentId, ref.ParentSpanId)
+		return ids.SpanID(ref.ParentTraceSegmentId, ref.ParentSpanId)
 	} else {
-		return convertToOtelSpanID(data.GetTraceSegmentId(), span.GetParentSpanId())
+		return ids.SpanID(data.GetTraceSegmentId(), span.GetParentSpanId())
 	}
 }
 
-func getLinks(span *agentV3.SpanObject) string {
+func getLinks(ids idEncoder, span *agentV3.SpanObject) string {
 	if len(span.Refs) == 0 {
 		return "[]"
 	}
@@ -141,8 +225,8 @@ func getLinks(span *agentV3.SpanObject) string {
 	for _, ref := range span.Refs {
 		r := make(map[string]string)
 
-		r["traceId"] = ref.TraceId
-		r["spanID"] = convertToOtelSpanID(ref.ParentTraceSegmentId, ref.ParentSpanId)
+		r["traceId"] = ids.TraceID(ref.TraceId)
+		r["spanID"] = ids.SpanID(ref.ParentTraceSegmentId, ref.ParentSpanId)
 		r["traceState"] = ""
 
 		links = append(links, r)
@@ -156,17 +240,29 @@ func getLinks(span *agentV3.SpanObject) string {
 
 }
 
-func getAttribute(data *agentV3.SegmentObject, span *agentV3.SpanObject) string {
-	if len(span.Tags) == 0 {
-		return "{}"
-	}
-
+func (c *convertImpl) getAttribute(data *agentV3.SegmentObject, span *agentV3.SpanObject) string {
 	attribute := make(map[string]string)
 
 	for _, tag := range span.Tags {
 		attribute[tag.Key] = tag.Value
 	}
 
+	attribute = c.tags.mapAttribute(attribute)
+	c.tags.mapPeer(attribute, span.GetPeer())
+
+	attribute[AttributeComponent] = c.components.name(span.GetComponentId())
+	attribute[AttributeLayer] = span.GetSpanLayer().String()
+	attribute[AttributeSkipAnalysis] = strconv.FormatBool(span.GetSkipAnalysis())
+	if span.GetPeer() != "" {
+		attribute[AttributePeer] = span.GetPeer()
+	}
+
+	if c.ids.KeepOriginal() {
+		attribute[AttributeSkyWalkingTraceID] = data.GetTraceId()
+		attribute[AttributeSkyWalkingSegmentID] = data.GetTraceSegmentId()
+		attribute[AttributeSkyWalkingSpanID] = strconv.Itoa(int(span.GetSpanId()))
+	}
+
 	if l, err := json.Marshal(attribute); err == nil {
 		return string(l)
 	} else {
@@ -209,14 +305,6 @@ func getResource(data *agentV3.SegmentObject) string {
 	}
 }
 
-func getStatusCode(span *agentV3.SpanObject) string {
-	if span.GetIsError() {
-		return "ERROR"
-	} else {
-		return "SUCCESS"
-	}
-}
-
 func getSpanKind(span *agentV3.SpanObject) string {
 	switch {
 	case span.SpanLayer == agentV3.SpanLayer_MQ:
@@ -254,6 +342,7 @@ func (c *convertImpl) convertToMetric() {
 func (c *convertImpl) convertMetric(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
 	defer func() {
 		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting metric", zap.Any("panic", err))
 			e = fmt.Errorf("Failed to convert metric")
 		}
 	}()
@@ -270,11 +359,11 @@ func (c *convertImpl) convertMetric(data []byte) (l *sls.LogGroup, a modules.Dat
 	logs := make([]*sls.Log, 0)
 
 	for _, metric := range jvmMetric.Metrics {
-		c.convertCPU(jvmMetric, metric, metric.Cpu, logs)
-		c.convertMemoryData(jvmMetric, metric, metric.Memory, logs)
-		c.convertGCData(jvmMetric, metric, metric.Gc, logs)
-		c.convertMemoryPool(jvmMetric, metric, metric.MemoryPool, logs)
-		c.convertThread(jvmMetric, metric, logs)
+		logs = c.convertCPU(jvmMetric, metric, metric.GetCpu(), logs)
+		logs = c.convertMemoryData(jvmMetric, metric, metric.GetMemory(), logs)
+		logs = c.convertGCData(jvmMetric, metric, metric.GetGc(), logs)
+		logs = c.convertMemoryPool(jvmMetric, metric, metric.GetMemoryPool(), logs)
+		logs = c.convertThread(jvmMetric, metric, metric.GetThread(), logs)
 	}
 	return &sls.LogGroup{
 		Source: proto.String("0.0.0.0"),
@@ -283,21 +372,29 @@ func (c *convertImpl) convertMetric(data []byte) (l *sls.LogGroup, a modules.Dat
 
 }
 
-func (c *convertImpl) convertThread(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, logs []*sls.Log) error {
+func (c *convertImpl) convertThread(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, thread *agentV3.Thread, logs []*sls.Log) []*sls.Log {
+	if thread == nil {
+		return logs
+	}
+
 	serviceName := newPair("service", jvmMetric.GetService())
 	serviceInstance := newPair("serviceInstance", jvmMetric.GetServiceInstance())
 
-	logs = append(logs, newMetric("skywalking_jvm_threads_live", metric.Time, strconv.FormatInt(metric.Thread.LiveCount, 10), serviceName, serviceInstance))
-	logs = append(logs, newMetric("skywalking_jvm_threads_daemon", metric.Time, strconv.FormatInt(metric.Thread.DaemonCount, 10), serviceName, serviceInstance))
-	logs = append(logs, newMetric("skywalking_jvm_threads_peak", metric.Time, strconv.FormatInt(metric.Thread.PeakCount, 10), serviceName, serviceInstance))
-	return nil
+	logs = append(logs, newMetric("skywalking_jvm_threads_live", metric.GetTime(), strconv.FormatInt(thread.GetLiveCount(), 10), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_jvm_threads_daemon", metric.GetTime(), strconv.FormatInt(thread.GetDaemonCount(), 10), serviceName, serviceInstance))
+	logs = append(logs, newMetric("skywalking_jvm_threads_peak", metric.GetTime(), strconv.FormatInt(thread.GetPeakCount(), 10), serviceName, serviceInstance))
+	return logs
 }
 
-func (c *convertImpl) convertCPU(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, cpu *v3.CPU, logs []*sls.Log) error {
+func (c *convertImpl) convertCPU(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, cpu *v3.CPU, logs []*sls.Log) []*sls.Log {
+	if cpu == nil {
+		return logs
+	}
+
 	serviceName := newPair("service", jvmMetric.GetService())
 	serviceInstance := newPair("serviceInstance", jvmMetric.GetServiceInstance())
-	logs = append(logs, newMetric("skywalking_jvm_cpu_usage", metric.Time, strconv.FormatFloat(cpu.UsagePercent, 'f', 6, 64), serviceName, serviceInstance))
-	return nil
+	logs = append(logs, newMetric("skywalking_jvm_cpu_usage", metric.GetTime(), strconv.FormatFloat(cpu.GetUsagePercent(), 'f', 6, 64), serviceName, serviceInstance))
+	return logs
 }
 
 type Pair struct {
@@ -352,9 +449,9 @@ func newMetric(metric string, time int64, value string, labels ...*Pair) *sls.Lo
 	}
 }
 
-func (c *convertImpl) convertMemoryPool(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, memoryPool []*agentV3.MemoryPool, logs []*sls.Log) (e error) {
+func (c *convertImpl) convertMemoryPool(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, memoryPool []*agentV3.MemoryPool, logs []*sls.Log) []*sls.Log {
 	if len(memoryPool) == 0 {
-		return nil
+		return logs
 	}
 
 	serviceName := newPair("service", jvmMetric.GetService())
@@ -368,12 +465,12 @@ func (c *convertImpl) convertMemoryPool(jvmMetric *agentV3.JVMMetricCollection,
 		logs = append(logs, newMetric("skywalking_jvm_memory_pool_used", metric.GetTime(), strconv.FormatInt(i.Used, 10), serviceName, serviceInstance, memoryType))
 	}
 
-	return nil
+	return logs
 }
 
-func (c *convertImpl) convertGCData(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, gc []*agentV3.GC, logs []*sls.Log) (e error) {
+func (c *convertImpl) convertGCData(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, gc []*agentV3.GC, logs []*sls.Log) []*sls.Log {
 	if len(gc) == 0 {
-		return nil
+		return logs
 	}
 
 	serviceName := newPair("service", jvmMetric.GetService())
@@ -385,12 +482,12 @@ func (c *convertImpl) convertGCData(jvmMetric *agentV3.JVMMetricCollection, metr
 		logs = append(logs, newMetric("skywalking_jvm_gc_count", metric.GetTime(), strconv.FormatInt(g.GetCount(), 10), phrase, serviceName, serviceInstance))
 	}
 
-	return nil
+	return logs
 }
 
-func (c *convertImpl) convertMemoryData(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, memory []*agentV3.Memory, logs []*sls.Log) (e error) {
+func (c *convertImpl) convertMemoryData(jvmMetric *agentV3.JVMMetricCollection, metric *agentV3.JVMMetric, memory []*agentV3.Memory, logs []*sls.Log) []*sls.Log {
 	if len(memory) == 0 {
-		return nil
+		return logs
 	}
 
 	serviceName := newPair("service", jvmMetric.GetService())
@@ -409,9 +506,115 @@ func (c *convertImpl) convertMemoryData(jvmMetric *agentV3.JVMMetricCollection,
 		logs = append(logs, newMetric("skywalking_jvm_memory_used", metric.GetTime(), strconv.FormatInt(m.Used, 10), serviceName, serviceInstance, memTypeLabel))
 	}
 
-	return e
+	return logs
 }
 
-func (c *convertImpl) convertLogging(data []byte) (*sls.LogGroup, modules.DataType, error) {
-	return nil, modules.LOGGING, nil
+func (c *convertImpl) convertLogging(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting logging", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert logging")
+		}
+	}()
+
+	logData := &loggingV3.LogData{}
+	if e = proto.Unmarshal(data, logData); e != nil {
+		return nil, modules.LOGGING, e
+	}
+
+	return c.convertLogData(logData)
+}
+
+// convertLogData redacts and converts a log, the other data converted to logs
+// is wrapped in a LogData first.
+func (c *convertImpl) convertLogData(logData *loggingV3.LogData) (*sls.LogGroup, modules.DataType, error) {
+	if c.redactor != nil {
+		c.redactor.redactLog(logData)
+	}
+
+	return &sls.LogGroup{
+		Topic:  proto.String(""),
+		Source: proto.String("0.0.0.0"),
+		Logs:   []*sls.Log{c.logDataToLog(logData)},
+	}, modules.LOGGING, nil
+}
+
+func (c *convertImpl) logDataToLog(data *loggingV3.LogData) *sls.Log {
+	contents := make([]*sls.LogContent, 0)
+	traceContext := data.GetTraceContext()
+
+	timestamp := data.GetTimestamp()
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	// trace id
+	contents = append(contents, appendAttributeToLogContent(TraceIDField, c.ids.TraceID(traceContext.GetTraceId())))
+	// span id
+	contents = append(contents, appendAttributeToLogContent(SpanIDField, getLogSpanId(c.ids, traceContext)))
+	// segment id
+	contents = append(contents, appendAttributeToLogContent(LogSegmentID, traceContext.GetTraceSegmentId()))
+	// service
+	contents = append(contents, appendAttributeToLogContent(ServiceName, data.GetService()))
+	// service instance
+	contents = append(contents, appendAttributeToLogContent(LogServiceInstance, data.GetServiceInstance()))
+	// endpoint
+	contents = append(contents, appendAttributeToLogContent(LogEndpoint, data.GetEndpoint()))
+	// timestamp
+	contents = append(contents, appendAttributeToLogContent(LogTimestamp, strconv.FormatInt(timestamp, 10)))
+	// content
+	contentType, content := getLogBody(data.GetBody())
+	contents = append(contents, appendAttributeToLogContent(LogContentType, contentType))
+	contents = append(contents, appendAttributeToLogContent(LogContent, content))
+	// tags
+	contents = append(contents, appendAttributeToLogContent(LogTags, getLogTags(data.GetTags())))
+	// layer
+	contents = append(contents, appendAttributeToLogContent(LogLayer, data.GetLayer()))
+	// original ids
+	if c.ids.KeepOriginal() {
+		contents = append(contents, appendAttributeToLogContent(LogSkyWalkingTraceID, traceContext.GetTraceId()))
+		contents = append(contents, appendAttributeToLogContent(LogSkyWalkingSpanID, getLogSpanId(&skywalkingIDEncoder{}, traceContext)))
+	}
+
+	return &sls.Log{
+		Time:     proto.Uint32(uint32(timestamp / int64(1000))),
+		Contents: contents,
+	}
+}
+
+func getLogSpanId(ids idEncoder, traceContext *loggingV3.TraceContext) string {
+	if traceContext.GetTraceSegmentId() == "" {
+		return ""
+	}
+	return ids.SpanID(traceContext.GetTraceSegmentId(), traceContext.GetSpanId())
+}
+
+func getLogBody(body *loggingV3.LogDataBody) (string, string) {
+	switch content := body.GetContent().(type) {
+	case *loggingV3.LogDataBody_Text:
+		return "text", content.Text.GetText()
+	case *loggingV3.LogDataBody_Json:
+		return "json", content.Json.GetJson()
+	case *loggingV3.LogDataBody_Yaml:
+		return "yaml", content.Yaml.GetYaml()
+	default:
+		return body.GetType(), ""
+	}
+}
+
+func getLogTags(tags *loggingV3.LogTags) string {
+	if len(tags.GetData()) == 0 {
+		return "{}"
+	}
+
+	t := make(map[string]string)
+	for _, tag := range tags.GetData() {
+		t[tag.Key] = tag.Value
+	}
+
+	if d, err := json.Marshal(t); err == nil {
+		return string(d)
+	} else {
+		return "{}"
+	}
 }
@@ -0,0 +1,1137 @@
+package converter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	eventV3 "skywalking.apache.org/repo/goapi/collect/event/v3"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	profileV3 "skywalking.apache.org/repo/goapi/collect/language/profile/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+)
+
+// testConfiguration overrides the converter settings used by a test, other
+// settings are not read by the converter.
+type testConfiguration struct {
+	configure.Configuration
+	idEncoding   string
+	dropOriginal bool
+	// componentLibraries the component-libraries.yml overriding the built-in one
+	componentLibraries string
+	statusCodes        string
+	dependencyWindow   time.Duration
+	redMetrics         bool
+	redactionRules     string
+	// decoders maps the topics to their decoders
+	decoders map[string]string
+}
+
+func (c *testConfiguration) Decoder(topic string) string {
+	return c.decoders[topic]
+}
+
+func (c *testConfiguration) Namespace(topic string) string {
+	return ""
+}
+
+func (c *testConfiguration) IDEncoding() string {
+	return c.idEncoding
+}
+
+func (c *testConfiguration) KeepOriginalTags() bool {
+	return !c.dropOriginal
+}
+
+func (c *testConfiguration) ComponentLibraries() string {
+	return c.componentLibraries
+}
+
+func (c *testConfiguration) StatusCodes() string {
+	return c.statusCodes
+}
+
+func (c *testConfiguration) DependencyWindow() time.Duration {
+	return c.dependencyWindow
+}
+
+func (c *testConfiguration) REDMetrics() bool {
+	return c.redMetrics
+}
+
+func (c *testConfiguration) REDBuckets() []float64 {
+	return []float64{10, 100}
+}
+
+func (c *testConfiguration) REDMaxEndpoints() int {
+	return 2
+}
+
+func (c *testConfiguration) RedactionRules() string {
+	return c.redactionRules
+}
+
+func newTestConverter(t *testing.T, config *testConfiguration) Converter {
+	c, err := NewConverter(config, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewConverter() error = %v", err)
+	}
+	return c
+}
+
+func TestConvertJVMMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *agentV3.JVMMetricCollection
+		want    []string
+	}{
+		{
+			name: "empty collection",
+			payload: &agentV3.JVMMetricCollection{
+				Service:         "order",
+				ServiceInstance: "order-1",
+			},
+			want: nil,
+		},
+		{
+			name: "cpu and thread",
+			payload: &agentV3.JVMMetricCollection{
+				Service:         "order",
+				ServiceInstance: "order-1",
+				Metrics: []*agentV3.JVMMetric{
+					{
+						Time:   1650000000000,
+						Cpu:    &v3.CPU{UsagePercent: 12.5},
+						Thread: &agentV3.Thread{LiveCount: 30, DaemonCount: 20, PeakCount: 32},
+					},
+				},
+			},
+			want: []string{
+				"skywalking_jvm_cpu_usage|service#$#order|serviceInstance#$#order-1|12.500000",
+				"skywalking_jvm_threads_live|service#$#order|serviceInstance#$#order-1|30",
+				"skywalking_jvm_threads_daemon|service#$#order|serviceInstance#$#order-1|20",
+				"skywalking_jvm_threads_peak|service#$#order|serviceInstance#$#order-1|32",
+			},
+		},
+		{
+			name: "memory, gc and memory pool",
+			payload: &agentV3.JVMMetricCollection{
+				Service:         "payment",
+				ServiceInstance: "payment-1",
+				Metrics: []*agentV3.JVMMetric{
+					{
+						Time: 1650000000000,
+						Memory: []*agentV3.Memory{
+							{IsHeap: true, Init: 1, Max: 4, Used: 2, Committed: 3},
+							{IsHeap: false, Init: 5, Max: 8, Used: 6, Committed: 7},
+						},
+						Gc: []*agentV3.GC{
+							{Phase: agentV3.GCPhase_NEW, Count: 10, Time: 100},
+						},
+						MemoryPool: []*agentV3.MemoryPool{
+							{Type: agentV3.PoolType_NEWGEN_USAGE, Init: 9, Max: 12, Used: 10, Committed: 11},
+						},
+					},
+				},
+			},
+			want: []string{
+				"skywalking_jvm_memory_committed|service#$#payment|serviceInstance#$#payment-1|type#$#heap|3",
+				"skywalking_jvm_memory_init|service#$#payment|serviceInstance#$#payment-1|type#$#heap|1",
+				"skywalking_jvm_memory_max|service#$#payment|serviceInstance#$#payment-1|type#$#heap|4",
+				"skywalking_jvm_memory_used|service#$#payment|serviceInstance#$#payment-1|type#$#heap|2",
+				"skywalking_jvm_memory_committed|service#$#payment|serviceInstance#$#payment-1|type#$#nonheap|7",
+				"skywalking_jvm_memory_init|service#$#payment|serviceInstance#$#payment-1|type#$#nonheap|5",
+				"skywalking_jvm_memory_max|service#$#payment|serviceInstance#$#payment-1|type#$#nonheap|8",
+				"skywalking_jvm_memory_used|service#$#payment|serviceInstance#$#payment-1|type#$#nonheap|6",
+				"skywalking_jvm_gc_time|phrase#$#NEW|service#$#payment|serviceInstance#$#payment-1|100",
+				"skywalking_jvm_gc_count|phrase#$#NEW|service#$#payment|serviceInstance#$#payment-1|10",
+				"skywalking_jvm_memory_pool_committed|service#$#payment|serviceInstance#$#payment-1|type#$#NEWGEN_USAGE|11",
+				"skywalking_jvm_memory_pool_init|service#$#payment|serviceInstance#$#payment-1|type#$#NEWGEN_USAGE|9",
+				"skywalking_jvm_memory_pool_max|service#$#payment|serviceInstance#$#payment-1|type#$#NEWGEN_USAGE|12",
+				"skywalking_jvm_memory_pool_used|service#$#payment|serviceInstance#$#payment-1|type#$#NEWGEN_USAGE|10",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := proto.Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("marshal payload: %v", err)
+			}
+
+			logGroup, dataType, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.MetricOriginData{D: payload})
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if dataType != modules.METRIC {
+				t.Errorf("Convert() data type = %v, want %v", dataType, modules.METRIC)
+			}
+
+			if got := flattenMetrics(logGroup); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Convert() metrics mismatch\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConvertJVMMetricRecorded converts the serialized JVMMetricCollection of
+// a Java agent running G1, two reports of every pool, gc phase and thread
+// count. The expected metrics are listed in jvm-metrics.txt.
+func TestConvertJVMMetricRecorded(t *testing.T) {
+	payload, err := ioutil.ReadFile(filepath.Join("testdata", "jvm-metrics.bin"))
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "jvm-metrics.txt"))
+	if err != nil {
+		t.Fatalf("read expected metrics: %v", err)
+	}
+
+	logGroup, _, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.MetricOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if got := strings.Join(flattenMetrics(logGroup), "\n") + "\n"; got != string(want) {
+		t.Errorf("Convert() metrics mismatch\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestConvertJVMMetricMalformed(t *testing.T) {
+	if _, _, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.MetricOriginData{D: []byte{0xff, 0xff}}); err == nil {
+		t.Errorf("Convert() expected error for malformed payload")
+	}
+}
+
+func flattenMetrics(logGroup *sls.LogGroup) []string {
+	if logGroup == nil {
+		return nil
+	}
+
+	var result []string
+	for _, log := range logGroup.Logs {
+		contents := make(map[string]string)
+		for _, c := range log.Contents {
+			contents[c.GetKey()] = c.GetValue()
+		}
+		result = append(result, fmt.Sprintf("%s|%s|%s", contents["__name__"], contents["__labels__"], contents["__value__"]))
+	}
+	return result
+}
+
+func TestConvertSegmentIDEncoding(t *testing.T) {
+	segment := &agentV3.SegmentObject{
+		TraceId:        "a1b2c3.44.16500000000000001",
+		TraceSegmentId: "d4e5f6.55.16500000000000002",
+		Service:        "order",
+		Spans: []*agentV3.SpanObject{
+			{
+				SpanId:       0,
+				ParentSpanId: -1,
+				Refs: []*agentV3.SegmentReference{
+					{TraceId: "a1b2c3.44.16500000000000001", ParentTraceSegmentId: "g7h8i9.66.16500000000000003", ParentSpanId: 2},
+				},
+			},
+			{SpanId: 1, ParentSpanId: 0},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		idEncoding string
+		traceID    string
+		spanIDs    []string
+		parentIDs  []string
+	}{
+		{
+			name:       "skywalking",
+			idEncoding: configure.ID_ENCODING_SKYWALKING,
+			traceID:    "a1b2c3.44.16500000000000001",
+			spanIDs:    []string{"d4e5f6.55.16500000000000002.0", "d4e5f6.55.16500000000000002.1"},
+			parentIDs:  []string{"g7h8i9.66.16500000000000003.2", "d4e5f6.55.16500000000000002.0"},
+		},
+		{
+			name:       "otel",
+			idEncoding: configure.ID_ENCODING_OTEL,
+			traceID:    (&otelIDEncoder{}).TraceID("a1b2c3.44.16500000000000001"),
+			spanIDs: []string{
+				(&otelIDEncoder{}).SpanID("d4e5f6.55.16500000000000002", 0),
+				(&otelIDEncoder{}).SpanID("d4e5f6.55.16500000000000002", 1),
+			},
+			parentIDs: []string{
+				(&otelIDEncoder{}).SpanID("g7h8i9.66.16500000000000003", 2),
+				(&otelIDEncoder{}).SpanID("d4e5f6.55.16500000000000002", 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := proto.Marshal(segment)
+			if err != nil {
+				t.Fatalf("marshal payload: %v", err)
+			}
+
+			logGroup, _, err := newTestConverter(t, &testConfiguration{idEncoding: tt.idEncoding}).Convert(&modules.SegmentOriginData{D: payload})
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+
+			for i, log := range logGroup.Logs {
+				contents := make(map[string]string)
+				for _, c := range log.Contents {
+					contents[c.GetKey()] = c.GetValue()
+				}
+
+				if contents[TraceIDField] != tt.traceID {
+					t.Errorf("span %d trace id = %s, want %s", i, contents[TraceIDField], tt.traceID)
+				}
+				if contents[SpanIDField] != tt.spanIDs[i] {
+					t.Errorf("span %d span id = %s, want %s", i, contents[SpanIDField], tt.spanIDs[i])
+				}
+				if contents[ParentSpanID] != tt.parentIDs[i] {
+					t.Errorf("span %d parent span id = %s, want %s", i, contents[ParentSpanID], tt.parentIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOtelIDEncoder(t *testing.T) {
+	encoder := &otelIDEncoder{}
+
+	if id := encoder.TraceID("a1b2c3.44.16500000000000001"); len(id) != 32 || id != encoder.TraceID("a1b2c3.44.16500000000000001") {
+		t.Errorf("TraceID() = %s, want a stable 32 hex id", id)
+	}
+	if id := encoder.SpanID("d4e5f6.55.16500000000000002", 1); len(id) != 16 || id == encoder.SpanID("d4e5f6.55.16500000000000002", 2) {
+		t.Errorf("SpanID() = %s, want a distinct 16 hex id", id)
+	}
+}
+
+func TestTagMapper(t *testing.T) {
+	tests := []struct {
+		name         string
+		keepOriginal bool
+		tags         map[string]string
+		peer         string
+		want         map[string]string
+	}{
+		{
+			name:         "http",
+			keepOriginal: true,
+			tags:         map[string]string{"http.method": "GET", "url": "http://shop/order", "status_code": "200"},
+			peer:         "10.0.0.1:8080",
+			want: map[string]string{
+				"http.method": "GET", "url": "http://shop/order", "status_code": "200",
+				"http.url": "http://shop/order", "http.status_code": "200",
+				"net.peer.ip": "10.0.0.1", "net.peer.port": "8080",
+			},
+		},
+		{
+			name: "database",
+			tags: map[string]string{"db.type": "Mysql", "db.instance": "orders", "db.statement": "select 1"},
+			peer: "mysql.local:3306",
+			want: map[string]string{
+				"db.system": "mysql", "db.name": "orders", "db.statement": "select 1",
+				"net.peer.name": "mysql.local", "net.peer.port": "3306",
+			},
+		},
+		{
+			name: "messaging",
+			tags: map[string]string{"mq.topic": "orders", "mq.broker": "kafka:9092"},
+			peer: "kafka-1:9092,kafka-2:9092",
+			want: map[string]string{
+				"messaging.destination": "orders", "messaging.destination_kind": "topic", "messaging.url": "kafka:9092",
+				"net.peer.name": "kafka-1:9092,kafka-2:9092",
+			},
+		},
+		{
+			name: "queue and topic",
+			tags: map[string]string{"mq.topic": "orders", "mq.queue": "order-queue"},
+			want: map[string]string{"messaging.destination": "order-queue", "messaging.destination_kind": "queue"},
+		},
+		{
+			name: "existing attribute wins",
+			tags: map[string]string{"cache.type": "Redis", "cache.key": "k", "db.system": "redis-cluster"},
+			want: map[string]string{"db.system": "redis-cluster", "cache.key": "k"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := &tagMapper{keepOriginal: tt.keepOriginal}
+			attribute := make(map[string]string)
+			for k, v := range tt.tags {
+				attribute[k] = v
+			}
+
+			attribute = mapper.mapAttribute(attribute)
+			mapper.mapPeer(attribute, tt.peer)
+
+			if !reflect.DeepEqual(attribute, tt.want) {
+				t.Errorf("attribute = %v, want %v", attribute, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentLibraries(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "component-libraries.yml")
+	override := "Tomcat:\n  id: 1\n  languages: Java\nMyRPC:\n  id: 9001\n  languages: Java\nComponent-Server-Mappings:\n  mysql-connector-java: Mysql\n"
+	if err := ioutil.WriteFile(file, []byte(override), 0644); err != nil {
+		t.Fatalf("write component libraries: %v", err)
+	}
+
+	segment := &agentV3.SegmentObject{
+		TraceId:        "a1b2c3.44.16500000000000001",
+		TraceSegmentId: "d4e5f6.55.16500000000000002",
+		Service:        "order",
+		Spans: []*agentV3.SpanObject{
+			{SpanId: 0, ParentSpanId: -1, SpanType: agentV3.SpanType_Entry, SpanLayer: agentV3.SpanLayer_Http, ComponentId: 1},
+			{SpanId: 1, ParentSpanId: 0, SpanType: agentV3.SpanType_Exit, SpanLayer: agentV3.SpanLayer_Database, ComponentId: 33, Peer: "mysql:3306"},
+			{SpanId: 2, ParentSpanId: 0, SpanType: agentV3.SpanType_Exit, SpanLayer: agentV3.SpanLayer_RPCFramework, ComponentId: 9001, SkipAnalysis: true},
+			{SpanId: 3, ParentSpanId: 0, SpanType: agentV3.SpanType_Local, ComponentId: 9002},
+		},
+	}
+	want := []map[string]string{
+		{AttributeComponent: "Tomcat", AttributeLayer: "Http", AttributeSkipAnalysis: "false"},
+		{AttributeComponent: "mysql-connector-java", AttributeLayer: "Database", AttributeSkipAnalysis: "false", AttributePeer: "mysql:3306"},
+		{AttributeComponent: "MyRPC", AttributeLayer: "RPCFramework", AttributeSkipAnalysis: "true"},
+		{AttributeComponent: "9002", AttributeLayer: "Unknown", AttributeSkipAnalysis: "false"},
+	}
+
+	payload, err := proto.Marshal(segment)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, _, err := newTestConverter(t, &testConfiguration{componentLibraries: file}).Convert(&modules.SegmentOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	for i, log := range logGroup.Logs {
+		attribute := make(map[string]string)
+		for _, c := range log.Contents {
+			if c.GetKey() == Attribute {
+				if err := json.Unmarshal([]byte(c.GetValue()), &attribute); err != nil {
+					t.Fatalf("unmarshal attribute: %v", err)
+				}
+			}
+		}
+		for k, v := range want[i] {
+			if attribute[k] != v {
+				t.Errorf("span %d attribute %s = %q, want %q", i, k, attribute[k], v)
+			}
+		}
+		if _, ok := want[i][AttributePeer]; !ok && attribute[AttributePeer] != "" {
+			t.Errorf("span %d attribute %s = %q, want none", i, AttributePeer, attribute[AttributePeer])
+		}
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	errorLog := &agentV3.Log{Data: []*v3.KeyStringValuePair{
+		{Key: "event", Value: "error"},
+		{Key: "error.kind", Value: "java.lang.IllegalStateException"},
+		{Key: "message", Value: "stock not enough"},
+		{Key: "stack", Value: "java.lang.IllegalStateException: stock not enough\n\tat Order.create"},
+	}}
+	stackLog := &agentV3.Log{Data: []*v3.KeyStringValuePair{
+		{Key: "event", Value: "error"},
+		{Key: "stack", Value: "panic: timeout"},
+	}}
+
+	tests := []struct {
+		name        string
+		statusCodes string
+		span        *agentV3.SpanObject
+		code        string
+		message     string
+	}{
+		{name: "success", statusCodes: configure.STATUS_CODES_SKYWALKING, span: &agentV3.SpanObject{}, code: "SUCCESS"},
+		{name: "unset", statusCodes: configure.STATUS_CODES_OTEL, span: &agentV3.SpanObject{}, code: "UNSET"},
+		{
+			name:        "error log",
+			statusCodes: configure.STATUS_CODES_OTEL,
+			span:        &agentV3.SpanObject{IsError: true, Logs: []*agentV3.Log{errorLog}},
+			code:        "ERROR",
+			message:     "java.lang.IllegalStateException: stock not enough",
+		},
+		{
+			name:        "stack only",
+			statusCodes: configure.STATUS_CODES_SKYWALKING,
+			span:        &agentV3.SpanObject{IsError: true, Logs: []*agentV3.Log{stackLog}},
+			code:        "ERROR",
+			message:     "panic: timeout",
+		},
+		{
+			name:        "http 5xx",
+			statusCodes: configure.STATUS_CODES_OTEL,
+			span:        &agentV3.SpanObject{Tags: []*v3.KeyStringValuePair{{Key: "status_code", Value: "503"}}},
+			code:        "ERROR",
+			message:     "HTTP 503",
+		},
+		{
+			name:        "http 4xx",
+			statusCodes: configure.STATUS_CODES_OTEL,
+			span:        &agentV3.SpanObject{Tags: []*v3.KeyStringValuePair{{Key: "status_code", Value: "404"}}},
+			code:        "UNSET",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message := newStatusCodes(&testConfiguration{statusCodes: tt.statusCodes}).status(tt.span)
+			if code != tt.code || message != tt.message {
+				t.Errorf("status() = (%s, %q), want (%s, %q)", code, message, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestDependencyAggregator(t *testing.T) {
+	window := time.Minute
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	ms := func(d time.Duration) int64 { return start.Add(d).UnixNano() / int64(time.Millisecond) }
+	ref := func(service string, refType agentV3.RefType) []*agentV3.SegmentReference {
+		return []*agentV3.SegmentReference{{RefType: refType, ParentService: service}}
+	}
+
+	segments := []*agentV3.SegmentObject{
+		{Service: "order", Spans: []*agentV3.SpanObject{
+			{OperationName: "/order", StartTime: ms(time.Second), EndTime: ms(time.Second + 20*time.Millisecond), Refs: ref("gateway", agentV3.RefType_CrossProcess)},
+			{OperationName: "async", StartTime: ms(time.Second), EndTime: ms(2 * time.Second), Refs: ref("order", agentV3.RefType_CrossThread)},
+			{OperationName: "query", StartTime: ms(time.Second), EndTime: ms(2 * time.Second)},
+		}},
+		{Service: "order", Spans: []*agentV3.SpanObject{
+			{OperationName: "/order", StartTime: ms(30 * time.Second), EndTime: ms(30*time.Second + 10*time.Millisecond), IsError: true, Refs: ref("gateway", agentV3.RefType_CrossProcess)},
+		}},
+		{Service: "order", Spans: []*agentV3.SpanObject{
+			{OperationName: "/order", StartTime: ms(window + time.Second), EndTime: ms(window + 2*time.Second), Refs: ref("gateway", agentV3.RefType_CrossProcess)},
+		}},
+	}
+
+	aggregator := newDependencyAggregator(window)
+	for _, segment := range segments {
+		for _, span := range segment.Spans {
+			aggregator.record("", segment, span)
+		}
+	}
+	aggregator.record("prod", segments[0], segments[0].Spans[0])
+
+	if groups, _ := aggregator.Flush(start.Add(window+time.Second), false); len(groups) != 0 {
+		t.Fatalf("Flush() before the grace period = %d groups, want none", len(groups))
+	}
+
+	groups, dataType := aggregator.Flush(start.Add(2*window), false)
+	if dataType != modules.DEPENDENCY || len(groups) != 2 {
+		t.Fatalf("Flush() = %v, %v, want the dependencies of two namespaces", groups, dataType)
+	}
+	namespaces := make(map[string]*sls.LogGroup)
+	for _, group := range groups {
+		namespaces[modules.NamespaceOf(group)] = group
+	}
+	data := namespaces[""]
+	if data == nil || len(data.Logs) != 1 || namespaces["prod"] == nil || len(namespaces["prod"].Logs) != 1 {
+		t.Fatalf("Flush() = %v, want one dependency per namespace", namespaces)
+	}
+	got := make(map[string]string)
+	for _, c := range data.Logs[0].Contents {
+		got[c.GetKey()] = c.GetValue()
+	}
+	want := map[string]string{
+		ParentService: "gateway", ChildService: "order", DependencyEndpoint: "/order", DependencyWindow: "60",
+		DependencyCalls: "2", DependencyErrors: "1", DependencyLatencySum: "30000",
+	}
+	if !reflect.DeepEqual(got, want) || data.Logs[0].GetTime() != uint32(start.Unix()) {
+		t.Errorf("dependency = %v at %d, want %v at %d", got, data.Logs[0].GetTime(), want, start.Unix())
+	}
+
+	// a late call of the flushed window is not emitted again
+	aggregator.record("", segments[0], segments[0].Spans[0])
+
+	if groups, _ := aggregator.Flush(start.Add(2*window), true); len(groups) != 1 || len(groups[0].Logs) != 1 ||
+		groups[0].Logs[0].GetTime() != uint32(start.Add(window).Unix()) {
+		t.Errorf("final Flush() = %v, want the remaining window", groups)
+	}
+}
+
+func TestREDAggregator(t *testing.T) {
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	ms := start.UnixNano() / int64(time.Millisecond)
+	span := func(endpoint string, duration int64, isError bool) *agentV3.SpanObject {
+		return &agentV3.SpanObject{SpanType: agentV3.SpanType_Entry, OperationName: endpoint, StartTime: ms, EndTime: ms + duration, IsError: isError}
+	}
+
+	segment := &agentV3.SegmentObject{
+		TraceId:         "a1b2c3.44.16500000000000001",
+		TraceSegmentId:  "d4e5f6.55.16500000000000002",
+		Service:         "order",
+		ServiceInstance: "order-1",
+		Spans: []*agentV3.SpanObject{
+			span("/order", 5, false),
+			span("/order", 50, false),
+			span("/order", 500, true),
+			span("/stock", 20, false),
+			span("/order/1", 20, false),
+			{SpanType: agentV3.SpanType_Exit, OperationName: "select", StartTime: ms, EndTime: ms + 1},
+		},
+	}
+	payload, err := proto.Marshal(segment)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+
+	c := newTestConverter(t, &testConfiguration{redMetrics: true, statusCodes: configure.STATUS_CODES_OTEL})
+	if _, _, err := c.Convert(&modules.SegmentOriginData{D: payload}); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	aggregators := c.Aggregators()
+	if len(aggregators) != 1 {
+		t.Fatalf("Aggregators() = %d, want 1", len(aggregators))
+	}
+	if groups, _ := aggregators[0].Flush(start.Add(time.Minute), false); len(groups) != 0 {
+		t.Fatalf("Flush() before the grace period = %d groups, want none", len(groups))
+	}
+	groups, dataType := aggregators[0].Flush(start.Add(2*time.Minute), false)
+	if dataType != modules.METRIC || len(groups) != 1 {
+		t.Fatalf("Flush() = %v, %v, want metrics", groups, dataType)
+	}
+	data := groups[0]
+
+	labels := "service#$#order|serviceInstance#$#order-1|endpoint#$#%s|kind#$#server|status#$#%s"
+	want := []string{
+		"skywalking_endpoint_calls|" + fmt.Sprintf(labels, "/order", "UNSET") + "|2",
+		"skywalking_endpoint_duration_ms_count|" + fmt.Sprintf(labels, "/order", "UNSET") + "|2",
+		"skywalking_endpoint_duration_ms_sum|" + fmt.Sprintf(labels, "/order", "UNSET") + "|55",
+		"skywalking_endpoint_duration_ms_bucket|" + fmt.Sprintf(labels, "/order", "UNSET") + "|le#$#10|1",
+		"skywalking_endpoint_duration_ms_bucket|" + fmt.Sprintf(labels, "/order", "UNSET") + "|le#$#100|2",
+		"skywalking_endpoint_duration_ms_bucket|" + fmt.Sprintf(labels, "/order", "UNSET") + "|le#$#+Inf|2",
+		"skywalking_endpoint_calls|" + fmt.Sprintf(labels, "/order", "ERROR") + "|1",
+		"skywalking_endpoint_duration_ms_bucket|" + fmt.Sprintf(labels, "/order", "ERROR") + "|le#$#100|0",
+		"skywalking_endpoint_calls|" + fmt.Sprintf(labels, "/stock", "UNSET") + "|1",
+		"skywalking_endpoint_calls|" + fmt.Sprintf(labels, "_other", "UNSET") + "|1",
+	}
+
+	got := make(map[string]bool)
+	for _, metric := range flattenMetrics(data) {
+		got[metric] = true
+	}
+	for _, metric := range want {
+		if !got[metric] {
+			t.Errorf("missing metric %s", metric)
+		}
+	}
+	if len(got) != 4*6 {
+		t.Errorf("got %d metrics, want %d series of 6 metrics", len(got), 4)
+	}
+
+	// spans of the flushed window are not emitted again, and the endpoints
+	// are limited per window
+	next := start.Add(2*time.Minute).UnixNano() / int64(time.Millisecond)
+	segment.Spans = append(segment.Spans, &agentV3.SpanObject{SpanType: agentV3.SpanType_Entry, OperationName: "/order/1", StartTime: next, EndTime: next + 20})
+	if payload, err = proto.Marshal(segment); err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	if _, _, err := c.Convert(&modules.SegmentOriginData{D: payload}); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	groups, _ = aggregators[0].Flush(start.Add(2*time.Minute), true)
+	if len(groups) != 1 {
+		t.Fatalf("final Flush() = %d groups, want 1", len(groups))
+	}
+	if metrics := flattenMetrics(groups[0]); len(metrics) != 6 || metrics[0] != "skywalking_endpoint_calls|"+fmt.Sprintf(labels, "/order/1", "UNSET")+"|1" {
+		t.Errorf("final Flush() = %q, want the series of /order/1 only", metrics)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "redaction.yml")
+	rules := `hash_key: secret
+rules:
+  - keys: [http.params]
+    action: drop
+  - keys: [user.id]
+    action: hash
+  - pattern: 'Bearer [A-Za-z0-9._-]+'
+    action: mask
+    replacement: Bearer ***
+  - pattern: '[a-z]+@example\.com'
+    action: mask
+  - keys: [db.statement, body]
+    action: truncate
+    max_length: 12
+  - pattern: '/users/[0-9]+'
+    action: mask
+    replacement: /users/{id}
+  - pattern: '^10\.[0-9.]+'
+    action: mask
+    replacement: internal
+services:
+  audit:
+    - keys: [user.id]
+      action: drop
+`
+	if err := ioutil.WriteFile(file, []byte(rules), 0644); err != nil {
+		t.Fatalf("write redaction rules: %v", err)
+	}
+	c := newTestConverter(t, &testConfiguration{redactionRules: file})
+
+	tags := func() []*v3.KeyStringValuePair {
+		return []*v3.KeyStringValuePair{
+			{Key: "http.params", Value: "password=secret"},
+			{Key: "user.id", Value: "42"},
+			{Key: "db.statement", Value: "select * from users where email = 'bob@example.com'"},
+		}
+	}
+	segment := &agentV3.SegmentObject{
+		TraceId:        "a1b2c3.44.16500000000000001",
+		TraceSegmentId: "d4e5f6.55.16500000000000002",
+		Service:        "order",
+		Spans: []*agentV3.SpanObject{{
+			SpanId:        0,
+			ParentSpanId:  -1,
+			OperationName: "/users/42/orders",
+			Peer:          "10.0.0.7:8080",
+			SpanType:      agentV3.SpanType_Exit,
+			Tags:          tags(),
+			Logs: []*agentV3.Log{{Data: []*v3.KeyStringValuePair{
+				{Key: "event", Value: "error"},
+				{Key: "message", Value: "invalid token Bearer abc.def for alice@example.com"},
+			}}},
+		}},
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("42"))
+	wantAttribute := map[string]string{"user.id": hex.EncodeToString(mac.Sum(nil)), "db.statement": "select * fro", AttributePeer: "internal:8080"}
+	wantLog := map[string]string{"event": "error", "message": "invalid token Bearer *** for ***"}
+
+	payload, err := proto.Marshal(segment)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, _, err := c.Convert(&modules.SegmentOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, content := range logGroup.Logs[0].Contents {
+		contents[content.GetKey()] = content.GetValue()
+	}
+	attribute := make(map[string]string)
+	if err := json.Unmarshal([]byte(contents[Attribute]), &attribute); err != nil {
+		t.Fatalf("unmarshal attribute: %v", err)
+	}
+	for k, v := range wantAttribute {
+		if attribute[k] != v {
+			t.Errorf("attribute %s = %q, want %q", k, attribute[k], v)
+		}
+	}
+	if contents[OperationName] != "/users/{id}/orders" {
+		t.Errorf("operation name = %q, want %q", contents[OperationName], "/users/{id}/orders")
+	}
+	if _, ok := attribute["http.params"]; ok {
+		t.Errorf("attribute http.params = %q, want dropped", attribute["http.params"])
+	}
+	var logs []map[string]string
+	if err := json.Unmarshal([]byte(contents[Logs]), &logs); err != nil {
+		t.Fatalf("unmarshal logs: %v", err)
+	}
+	for k, v := range wantLog {
+		if logs[0][k] != v {
+			t.Errorf("log %s = %q, want %q", k, logs[0][k], v)
+		}
+	}
+
+	logData := &loggingV3.LogData{
+		Service: "audit",
+		Body:    &loggingV3.LogDataBody{Content: &loggingV3.LogDataBody_Text{Text: &loggingV3.TextLog{Text: "login of bob@example.com"}}},
+		Tags:    &loggingV3.LogTags{Data: tags()},
+	}
+	payload, err = proto.Marshal(logData)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, _, err = c.Convert(&modules.LogggingOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	contents = make(map[string]string)
+	for _, content := range logGroup.Logs[0].Contents {
+		contents[content.GetKey()] = content.GetValue()
+	}
+	if contents[LogContent] != "login of bob@example.com" {
+		t.Errorf("content = %q, want the service rules to leave it untouched", contents[LogContent])
+	}
+	if contents[LogTags] != `{"db.statement":"select * from users where email = 'bob@example.com'","http.params":"password=secret"}` {
+		t.Errorf("tags = %s, want only user.id dropped", contents[LogTags])
+	}
+
+	logData.Service = "order"
+	payload, err = proto.Marshal(logData)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, _, err = c.Convert(&modules.LogggingOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	for _, content := range logGroup.Logs[0].Contents {
+		if content.GetKey() == LogContent && content.GetValue() != "login of ***" {
+			t.Errorf("content = %q, want %q", content.GetValue(), "login of ***")
+		}
+	}
+}
+
+func TestRedactionTruncateUTF8(t *testing.T) {
+	r := &redactor{}
+	rules := []*redactionRule{{Action: REDACT_TRUNCATE, MaxLength: 4}}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"abc", "abc"},
+		{"abcdef", "abcd"},
+		{"订单数据", "订"},
+		{"ab订单", "ab"},
+		{"abc订", "abc"},
+		{"a€b", "a€"},
+	}
+
+	for _, tt := range tests {
+		got, ok := r.redact(rules, "db.statement", tt.value)
+		if !ok || got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("redact(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRedactionHashKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "hash.key")
+	if err := ioutil.WriteFile(keyFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("write hash key: %v", err)
+	}
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{name: "key", rules: "hash_key: secret\nrules:\n  - action: hash\n"},
+		{name: "key file", rules: "hash_key_file: " + keyFile + "\nrules:\n  - action: hash\n"},
+		{name: "no hash rule", rules: "rules:\n  - action: drop\n"},
+		{name: "missing key", rules: "rules:\n  - action: drop\nservices:\n  audit:\n    - action: hash\n", wantErr: true},
+		{name: "key and file", rules: "hash_key: secret\nhash_key_file: " + keyFile + "\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, "redaction.yml")
+			if err := ioutil.WriteFile(file, []byte(tt.rules), 0644); err != nil {
+				t.Fatalf("write redaction rules: %v", err)
+			}
+			r, err := newRedactor(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRedactor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(r.rules) > 0 && r.rules[0].Action == REDACT_HASH && string(r.hashKey) != "secret" {
+				t.Errorf("hash key = %q, want %q", r.hashKey, "secret")
+			}
+		})
+	}
+}
+
+func TestConvertMeter(t *testing.T) {
+	meters := &agentV3.MeterDataCollection{MeterData: []*agentV3.MeterData{
+		{
+			Service:         "order",
+			ServiceInstance: "order-1",
+			Timestamp:       1650000000000,
+			Metric: &agentV3.MeterData_SingleValue{SingleValue: &agentV3.MeterSingleValue{
+				Name:   "orders.created",
+				Labels: []*agentV3.Label{{Name: "channel", Value: "app"}},
+				Value:  12.5,
+			}},
+		},
+		{
+			Metric: &agentV3.MeterData_Histogram{Histogram: &agentV3.MeterHistogram{
+				Name: "order_latency",
+				Values: []*agentV3.MeterBucketValue{
+					{IsNegativeInfinity: true, Count: 1},
+					{Bucket: 10, Count: 2},
+					{Bucket: 50, Count: 3},
+				},
+			}},
+		},
+	}}
+	labels := "service#$#order|serviceInstance#$#order-1"
+	want := []string{
+		"orders_created|" + labels + "|channel#$#app|12.5",
+		"order_latency_bucket|" + labels + "|le#$#10|1",
+		"order_latency_bucket|" + labels + "|le#$#50|3",
+		"order_latency_bucket|" + labels + "|le#$#+Inf|6",
+		"order_latency_count|" + labels + "|6",
+		"order_latency_sum|" + labels + "|170",
+	}
+
+	payload, err := proto.Marshal(meters)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, dataType, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.MeterOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if dataType != modules.METRIC {
+		t.Errorf("Convert() type = %v, want %v", dataType, modules.METRIC)
+	}
+	if got := flattenMetrics(logGroup); !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+	for _, log := range logGroup.Logs {
+		if log.GetTime() != 1650000000 {
+			t.Errorf("metric time = %d, want the meter timestamp", log.GetTime())
+		}
+	}
+}
+
+func TestConvertCLRMetric(t *testing.T) {
+	clrMetric := &agentV3.CLRMetricCollection{
+		Service:         "payment",
+		ServiceInstance: "payment-1",
+		Metrics: []*agentV3.CLRMetric{{
+			Time:   1650000000000,
+			Cpu:    &v3.CPU{UsagePercent: 12.5},
+			Gc:     &agentV3.ClrGC{Gen0CollectCount: 10, Gen1CollectCount: 3, Gen2CollectCount: 1, HeapMemory: 1048576},
+			Thread: &agentV3.ClrThread{AvailableCompletionPortThreads: 999, AvailableWorkerThreads: 30, MaxCompletionPortThreads: 1000, MaxWorkerThreads: 32},
+		}},
+	}
+	labels := "service#$#payment|serviceInstance#$#payment-1"
+	want := []string{
+		"skywalking_clr_cpu_usage|" + labels + "|12.500000",
+		"skywalking_clr_gc_count|generation#$#gen0|" + labels + "|10",
+		"skywalking_clr_gc_count|generation#$#gen1|" + labels + "|3",
+		"skywalking_clr_gc_count|generation#$#gen2|" + labels + "|1",
+		"skywalking_clr_heap_memory|" + labels + "|1048576",
+		"skywalking_clr_threads_available_completion_port|" + labels + "|999",
+		"skywalking_clr_threads_available_worker|" + labels + "|30",
+		"skywalking_clr_threads_max_completion_port|" + labels + "|1000",
+		"skywalking_clr_threads_max_worker|" + labels + "|32",
+	}
+
+	payload, err := proto.Marshal(clrMetric)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, dataType, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.CLRMetricOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if dataType != modules.METRIC {
+		t.Errorf("Convert() type = %v, want %v", dataType, modules.METRIC)
+	}
+	if got := flattenMetrics(logGroup); !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert() = %v, want %v", got, want)
+	}
+}
+
+func TestConvertBrowserPerf(t *testing.T) {
+	perf := &agentV3.BrowserPerfData{
+		Service:        "web",
+		ServiceVersion: "v1",
+		PagePath:       "/index.html",
+		Time:           1650000000000,
+		DnsTime:        12,
+		LoadPageTime:   830,
+	}
+
+	payload, err := proto.Marshal(perf)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	logGroup, dataType, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.BrowserPerfOriginData{D: payload})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if dataType != modules.METRIC {
+		t.Errorf("Convert() type = %v, want %v", dataType, modules.METRIC)
+	}
+
+	labels := "service#$#web|serviceVersion#$#v1|pagePath#$#/index.html"
+	got := flattenMetrics(logGroup)
+	for _, want := range []string{
+		"skywalking_browser_dns_time_ms|" + labels + "|12",
+		"skywalking_browser_load_page_time_ms|" + labels + "|830",
+	} {
+		found := false
+		for _, metric := range got {
+			found = found || metric == want
+		}
+		if !found {
+			t.Errorf("Convert() = %v, missing %v", got, want)
+		}
+	}
+	if len(got) != 14 {
+		t.Errorf("Convert() returned %d metrics, want 14", len(got))
+	}
+}
+
+func TestConvertLogs(t *testing.T) {
+	marshal := func(m proto.Message) []byte {
+		payload, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal payload: %v", err)
+		}
+		return payload
+	}
+
+	tests := []struct {
+		name string
+		data modules.OriginData
+		want map[string]string
+	}{
+		{
+			name: "browser error log",
+			data: &modules.BrowserErrorLogOriginData{D: marshal(&agentV3.BrowserErrorLog{
+				UniqueId:       "55ec6178",
+				Service:        "web",
+				ServiceVersion: "v1",
+				PagePath:       "/index.html",
+				Time:           1650000000000,
+				Category:       agentV3.ErrorCategory_js,
+				Message:        "undefined is not a function",
+				Stack:          "at main.js:10:5",
+			})},
+			want: map[string]string{
+				ServiceName:        "web",
+				LogServiceInstance: "v1",
+				LogEndpoint:        "/index.html",
+				LogContent:         "undefined is not a function\nat main.js:10:5",
+				LogLayer:           "BROWSER",
+			},
+		},
+		{
+			name: "event",
+			data: &modules.EventOriginData{D: marshal(&eventV3.Event{
+				Uuid:       "f498b3c0",
+				Source:     &eventV3.Source{Service: "order", ServiceInstance: "order-1"},
+				Name:       "Upgrade",
+				Message:    "Upgrade from v1 to v2",
+				Parameters: map[string]string{"from": "v1", "to": "v2"},
+				StartTime:  1650000000000,
+			})},
+			want: map[string]string{
+				ServiceName:        "order",
+				LogServiceInstance: "order-1",
+				LogContent:         "Upgrade from v1 to v2",
+			},
+		},
+		{
+			name: "thread snapshot",
+			data: &modules.ProfilingOriginData{D: marshal(&profileV3.ThreadSnapshot{
+				TaskId:         "task-1",
+				TraceSegmentId: "d4e5f6.55.16500000000000002",
+				Time:           1650000000000,
+				Sequence:       3,
+				Stack:          &profileV3.ThreadStack{CodeSignatures: []string{"java.lang.Thread.sleep", "com.example.Order.create"}},
+			})},
+			want: map[string]string{
+				LogSegmentID: "d4e5f6.55.16500000000000002",
+				LogContent:   "java.lang.Thread.sleep\ncom.example.Order.create",
+				LogLayer:     "PROFILING",
+			},
+		},
+	}
+
+	c := newTestConverter(t, &testConfiguration{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logGroup, dataType, err := c.Convert(tt.data)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if dataType != modules.LOGGING {
+				t.Errorf("Convert() type = %v, want %v", dataType, modules.LOGGING)
+			}
+			if len(logGroup.Logs) != 1 {
+				t.Fatalf("Convert() returned %d logs, want 1", len(logGroup.Logs))
+			}
+			contents := make(map[string]string)
+			for _, content := range logGroup.Logs[0].Contents {
+				contents[content.GetKey()] = content.GetValue()
+			}
+			for k, v := range tt.want {
+				if contents[k] != v {
+					t.Errorf("Convert() %s = %q, want %q", k, contents[k], v)
+				}
+			}
+			if logGroup.Logs[0].GetTime() != 1650000000 {
+				t.Errorf("Convert() time = %d, want 1650000000", logGroup.Logs[0].GetTime())
+			}
+		})
+	}
+}
+
+func TestConvertCLRMetricTopic(t *testing.T) {
+	config := &testConfiguration{decoders: map[string]string{
+		configure.CLR_METRIC_TOPIC: configure.DECODER_CLR_METRIC,
+		"dotnet-metrics":           configure.DECODER_CLR_METRIC,
+		configure.METRIC_TOPIC:     configure.DECODER_METRIC,
+	}}
+	payload, err := proto.Marshal(&agentV3.CLRMetricCollection{
+		Service:         "payment",
+		ServiceInstance: "payment-1",
+		Metrics:         []*agentV3.CLRMetric{{Time: 1650000000000, Cpu: &v3.CPU{UsagePercent: 12.5}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+
+	c := newTestConverter(t, config)
+	for _, topic := range []string{configure.CLR_METRIC_TOPIC, "dotnet-metrics"} {
+		data := modules.NewOriginData(config, modules.Metadata{Topic: topic}, payload)
+		if _, ok := data.(*modules.CLRMetricOriginData); !ok {
+			t.Fatalf("NewOriginData() of topic %s = %T, want *modules.CLRMetricOriginData", topic, data)
+		}
+		logGroup, _, err := c.Convert(data)
+		if err != nil {
+			t.Fatalf("Convert() error = %v", err)
+		}
+		want := []string{"skywalking_clr_cpu_usage|service#$#payment|serviceInstance#$#payment-1|12.500000"}
+		if got := flattenMetrics(logGroup); !reflect.DeepEqual(got, want) {
+			t.Errorf("Convert() of topic %s = %v, want %v", topic, got, want)
+		}
+	}
+
+	// CLR payloads can't be told from JVM payloads, the metric topic is always
+	// decoded as JVM metrics
+	data := modules.NewOriginData(config, modules.Metadata{Topic: configure.METRIC_TOPIC}, payload)
+	if _, ok := data.(*modules.MetricOriginData); !ok {
+		t.Errorf("NewOriginData() of the metric topic = %T, want *modules.MetricOriginData", data)
+	}
+}
+
+func TestConvertUnknownTopic(t *testing.T) {
+	logGroup, dataType, err := newTestConverter(t, &testConfiguration{}).Convert(&modules.UnknownOriginData{D: []byte("data")})
+	if err != nil || logGroup != nil || dataType != modules.NOOP {
+		t.Errorf("Convert() = %v, %v, %v, want nil, %v, nil", logGroup, dataType, err, modules.NOOP)
+	}
+}
@@ -0,0 +1,152 @@
+package converter
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// Aggregator accumulates records across messages and emits them once their
+// time window is closed.
+type Aggregator interface {
+	// Flush returns the records of the windows closed at now, or of every
+	// window if final is set, in one LogGroup per namespace. It returns nil if
+	// there is nothing to emit.
+	Flush(now time.Time, final bool) ([]*sls.LogGroup, modules.DataType)
+}
+
+// groupByNamespace wraps the logs of each namespace in a LogGroup tagged with
+// the namespace.
+func groupByNamespace(logs map[string][]*sls.Log, topic string, source string) []*sls.LogGroup {
+	groups := make([]*sls.LogGroup, 0, len(logs))
+	for namespace, l := range logs {
+		group := &sls.LogGroup{
+			Topic:  proto.String(topic),
+			Source: proto.String(source),
+			Logs:   l,
+		}
+		modules.SetNamespace(group, namespace)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+type dependencyEdge struct {
+	namespace     string
+	parentService string
+	childService  string
+	endpoint      string
+}
+
+type dependencyStatistics struct {
+	calls   int64
+	errors  int64
+	latency int64
+}
+
+// dependencyAggregator counts the calls between services per time window. A
+// call is the entry span of a segment referencing a segment of another
+// process.
+type dependencyAggregator struct {
+	window  time.Duration
+	lock    sync.Mutex
+	windows map[int64]map[dependencyEdge]*dependencyStatistics
+	// flushed is the start of the last window which has been flushed, calls of
+	// the windows starting at or before it are dropped
+	flushed int64
+}
+
+func newDependencyAggregator(window time.Duration) *dependencyAggregator {
+	return &dependencyAggregator{
+		window:  window,
+		windows: make(map[int64]map[dependencyEdge]*dependencyStatistics),
+	}
+}
+
+func (a *dependencyAggregator) record(namespace string, data *agentV3.SegmentObject, span *agentV3.SpanObject) {
+	if len(span.Refs) == 0 {
+		return
+	}
+
+	start := time.Unix(0, span.GetStartTime()*int64(time.Millisecond)).Truncate(a.window).UnixNano()
+	latency := (span.GetEndTime() - span.GetStartTime()) * 1000
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// Recreating a flushed window would emit it twice.
+	if start <= a.flushed {
+		monitor.LateRecords.WithLabelValues("dependency").Inc()
+		return
+	}
+
+	edges, ok := a.windows[start]
+	if !ok {
+		edges = make(map[dependencyEdge]*dependencyStatistics)
+		a.windows[start] = edges
+	}
+
+	for _, ref := range span.Refs {
+		if ref.GetRefType() != agentV3.RefType_CrossProcess {
+			continue
+		}
+
+		edge := dependencyEdge{namespace: namespace, parentService: ref.GetParentService(), childService: data.GetService(), endpoint: span.GetOperationName()}
+		statistics, ok := edges[edge]
+		if !ok {
+			statistics = &dependencyStatistics{}
+			edges[edge] = statistics
+		}
+		statistics.calls++
+		statistics.latency += latency
+		if isErrorSpan(span) {
+			statistics.errors++
+		}
+	}
+}
+
+// Flush emits a window once another window has passed after it closed, so that
+// segments reported late are still counted.
+func (a *dependencyAggregator) Flush(now time.Time, final bool) ([]*sls.LogGroup, modules.DataType) {
+	a.lock.Lock()
+	closed := make(map[int64]map[dependencyEdge]*dependencyStatistics)
+	if flushed := now.Add(-2 * a.window).Truncate(a.window).UnixNano(); flushed > a.flushed {
+		a.flushed = flushed
+	}
+	for start, edges := range a.windows {
+		if final || start <= a.flushed {
+			closed[start] = edges
+			delete(a.windows, start)
+		}
+	}
+	a.lock.Unlock()
+
+	if len(closed) == 0 {
+		return nil, modules.DEPENDENCY
+	}
+
+	logs := make(map[string][]*sls.Log)
+	for start, edges := range closed {
+		for edge, statistics := range edges {
+			logs[edge.namespace] = append(logs[edge.namespace], &sls.Log{
+				Time: proto.Uint32(uint32(start / int64(time.Second))),
+				Contents: []*sls.LogContent{
+					appendAttributeToLogContent(ParentService, edge.parentService),
+					appendAttributeToLogContent(ChildService, edge.childService),
+					appendAttributeToLogContent(DependencyEndpoint, edge.endpoint),
+					appendAttributeToLogContent(DependencyWindow, strconv.FormatInt(int64(a.window/time.Second), 10)),
+					appendAttributeToLogContent(DependencyCalls, strconv.FormatInt(statistics.calls, 10)),
+					appendAttributeToLogContent(DependencyErrors, strconv.FormatInt(statistics.errors, 10)),
+					appendAttributeToLogContent(DependencyLatencySum, strconv.FormatInt(statistics.latency, 10)),
+				},
+			})
+		}
+	}
+	return groupByNamespace(logs, "0.0.0.0", ""), modules.DEPENDENCY
+}
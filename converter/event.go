@@ -0,0 +1,55 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	eventV3 "skywalking.apache.org/repo/goapi/collect/event/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+)
+
+// convertEvent converts an event to a log of its source, the parameters are
+// kept in the tags.
+func (c *convertImpl) convertEvent(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting event", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert event")
+		}
+	}()
+
+	event := &eventV3.Event{}
+	if e = proto.Unmarshal(data, event); e != nil {
+		return nil, modules.LOGGING, e
+	}
+
+	tags := []*v3.KeyStringValuePair{
+		{Key: "uuid", Value: event.GetUuid()},
+		{Key: "name", Value: event.GetName()},
+		{Key: "type", Value: event.GetType().String()},
+		{Key: "startTime", Value: strconv.FormatInt(event.GetStartTime(), 10)},
+		{Key: "endTime", Value: strconv.FormatInt(event.GetEndTime(), 10)},
+	}
+	if len(event.GetParameters()) > 0 {
+		if parameters, err := json.Marshal(event.GetParameters()); err == nil {
+			tags = append(tags, &v3.KeyStringValuePair{Key: "parameters", Value: string(parameters)})
+		}
+	}
+
+	return c.convertLogData(&loggingV3.LogData{
+		Timestamp:       event.GetStartTime(),
+		Service:         event.GetSource().GetService(),
+		ServiceInstance: event.GetSource().GetServiceInstance(),
+		Endpoint:        event.GetSource().GetEndpoint(),
+		Body: &loggingV3.LogDataBody{
+			Content: &loggingV3.LogDataBody_Text{Text: &loggingV3.TextLog{Text: event.GetMessage()}},
+		},
+		Tags: &loggingV3.LogTags{Data: tags},
+	})
+}
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+)
+
+// idEncoder turns SkyWalking trace ids and (segment id, span id) pairs into
+// the ids written to SLS.
+type idEncoder interface {
+	TraceID(traceID string) string
+	SpanID(segmentID string, spanID int32) string
+	// KeepOriginal reports whether the original SkyWalking ids have to be kept
+	// as attributes because they can't be read from the encoded ids.
+	KeepOriginal() bool
+}
+
+func newIDEncoder(config configure.Configuration) idEncoder {
+	if config.IDEncoding() == configure.ID_ENCODING_OTEL {
+		return &otelIDEncoder{}
+	}
+	return &skywalkingIDEncoder{}
+}
+
+// skywalkingIDEncoder keeps the SkyWalking trace id and writes span ids as
+// <segmentId>.<spanId>.
+type skywalkingIDEncoder struct {
+}
+
+func (e *skywalkingIDEncoder) TraceID(traceID string) string {
+	return traceID
+}
+
+func (e *skywalkingIDEncoder) SpanID(segmentID string, spanID int32) string {
+	return convertToOtelSpanID(segmentID, spanID)
+}
+
+func (e *skywalkingIDEncoder) KeepOriginal() bool {
+	return false
+}
+
+// otelIDEncoder hashes trace ids to 16 bytes and span ids to 8 bytes, written
+// as 32 and 16 lower case hex characters like OpenTelemetry ids.
+type otelIDEncoder struct {
+}
+
+func (e *otelIDEncoder) TraceID(traceID string) string {
+	if traceID == "" {
+		return ""
+	}
+
+	h := fnv.New128a()
+	h.Write([]byte(traceID))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *otelIDEncoder) SpanID(segmentID string, spanID int32) string {
+	if segmentID == "" {
+		return ""
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(fmt.Sprintf("%s.%d", segmentID, spanID)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *otelIDEncoder) KeepOriginal() bool {
+	return true
+}
@@ -0,0 +1,128 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+func (c *convertImpl) convertMeter(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting meter", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert meter")
+		}
+	}()
+
+	meters := &agentV3.MeterDataCollection{}
+	if e = proto.Unmarshal(data, meters); e != nil {
+		return nil, modules.METRIC, e
+	}
+
+	if len(meters.MeterData) == 0 {
+		return nil, modules.METRIC, nil
+	}
+
+	logs := make([]*sls.Log, 0)
+
+	// Agents only set the service, instance and timestamp on the first meter of
+	// a collection.
+	service, serviceInstance, timestamp := "", "", int64(0)
+	for _, meter := range meters.MeterData {
+		if meter.GetService() != "" {
+			service = meter.GetService()
+		}
+		if meter.GetServiceInstance() != "" {
+			serviceInstance = meter.GetServiceInstance()
+		}
+		if meter.GetTimestamp() != 0 {
+			timestamp = meter.GetTimestamp()
+		}
+
+		labels := []*Pair{newPair("service", service), newPair("serviceInstance", serviceInstance)}
+		logs = c.convertSingleValue(meter.GetSingleValue(), timestamp, labels, logs)
+		logs = c.convertHistogram(meter.GetHistogram(), timestamp, labels, logs)
+	}
+	return &sls.LogGroup{
+		Source: proto.String("0.0.0.0"),
+		Logs:   logs,
+	}, modules.METRIC, nil
+}
+
+func (c *convertImpl) convertSingleValue(value *agentV3.MeterSingleValue, timestamp int64, labels []*Pair, logs []*sls.Log) []*sls.Log {
+	if value == nil {
+		return logs
+	}
+
+	labels = appendMeterLabels(labels, value.GetLabels())
+	return append(logs, newMetric(meterName(value.GetName()), timestamp, formatMeterValue(value.GetValue()), labels...))
+}
+
+// convertHistogram converts the buckets of a histogram into cumulative buckets.
+// SkyWalking reports the lower bound and the count of every bucket, so the
+// upper bound of a bucket is the lower bound of the next one. The sum is not
+// reported, it is estimated from the lower bounds.
+func (c *convertImpl) convertHistogram(histogram *agentV3.MeterHistogram, timestamp int64, labels []*Pair, logs []*sls.Log) []*sls.Log {
+	if histogram == nil {
+		return logs
+	}
+
+	name := meterName(histogram.GetName())
+	labels = appendMeterLabels(labels, histogram.GetLabels())
+	buckets := histogram.GetValues()
+
+	count, sum := int64(0), float64(0)
+	for i, bucket := range buckets {
+		count += bucket.GetCount()
+		if !bucket.GetIsNegativeInfinity() {
+			sum += bucket.GetBucket() * float64(bucket.GetCount())
+		}
+
+		le := "+Inf"
+		if i+1 < len(buckets) {
+			le = formatMeterValue(buckets[i+1].GetBucket())
+		}
+		logs = append(logs, newMetric(name+"_bucket", timestamp, strconv.FormatInt(count, 10), append(labels, newPair("le", le))...))
+	}
+	if len(buckets) == 0 {
+		logs = append(logs, newMetric(name+"_bucket", timestamp, strconv.FormatInt(count, 10), append(labels, newPair("le", "+Inf"))...))
+	}
+
+	logs = append(logs, newMetric(name+"_count", timestamp, strconv.FormatInt(count, 10), labels...))
+	logs = append(logs, newMetric(name+"_sum", timestamp, formatMeterValue(sum), labels...))
+	return logs
+}
+
+func appendMeterLabels(labels []*Pair, meterLabels []*agentV3.Label) []*Pair {
+	result := make([]*Pair, 0, len(labels)+len(meterLabels))
+	result = append(result, labels...)
+	for _, label := range meterLabels {
+		result = append(result, newPair(label.GetName(), label.GetValue()))
+	}
+	return result
+}
+
+// meterName replaces the characters Prometheus doesn't allow in metric names,
+// such as the dots of Micrometer meters.
+func meterName(name string) string {
+	return invalidMetricNameChars.ReplaceAllString(name, "_")
+}
+
+func formatMeterValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(value, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	profileV3 "skywalking.apache.org/repo/goapi/collect/language/profile/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+)
+
+// convertProfiling converts a thread snapshot of a profile task to a log of
+// the profiled segment, the stack is kept as the body one frame per line.
+func (c *convertImpl) convertProfiling(data []byte) (l *sls.LogGroup, a modules.DataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.logger.Debug("Recovered from converting thread snapshot", zap.Any("panic", err))
+			e = fmt.Errorf("Failed to convert thread snapshot")
+		}
+	}()
+
+	snapshot := &profileV3.ThreadSnapshot{}
+	if e = proto.Unmarshal(data, snapshot); e != nil {
+		return nil, modules.LOGGING, e
+	}
+
+	return c.convertLogData(&loggingV3.LogData{
+		Timestamp: snapshot.GetTime(),
+		Body: &loggingV3.LogDataBody{
+			Content: &loggingV3.LogDataBody_Text{Text: &loggingV3.TextLog{Text: strings.Join(snapshot.GetStack().GetCodeSignatures(), "\n")}},
+		},
+		TraceContext: &loggingV3.TraceContext{TraceSegmentId: snapshot.GetTraceSegmentId()},
+		Tags: &loggingV3.LogTags{Data: []*v3.KeyStringValuePair{
+			{Key: "taskId", Value: snapshot.GetTaskId()},
+			{Key: "sequence", Value: strconv.Itoa(int(snapshot.GetSequence()))},
+		}},
+		Layer: "PROFILING",
+	})
+}
@@ -0,0 +1,192 @@
+package converter
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+const (
+	redWindow = time.Minute
+	// redOtherEndpoint replaces the endpoints of a service beyond the limit
+	redOtherEndpoint = "_other"
+)
+
+type redSeries struct {
+	namespace       string
+	service         string
+	serviceInstance string
+	endpoint        string
+	kind            string
+	status          string
+}
+
+// redService identifies a service across namespaces.
+type redService struct {
+	namespace string
+	service   string
+}
+
+type redStatistics struct {
+	calls    int64
+	duration float64
+	// buckets counts the calls no longer than each bucket boundary, the last
+	// one counts calls of any duration
+	buckets []int64
+}
+
+// redWindowData is the series of a window and the endpoints of its services.
+type redWindowData struct {
+	series    map[redSeries]*redStatistics
+	endpoints map[redService]map[string]bool
+}
+
+// redAggregator counts the requests, errors and durations of the entry spans
+// of every endpoint per minute.
+type redAggregator struct {
+	statusCodes  *statusCodes
+	buckets      []float64
+	maxEndpoints int
+
+	lock    sync.Mutex
+	windows map[int64]*redWindowData
+	// flushed is the start of the last window which has been flushed, spans of
+	// the windows starting at or before it are dropped
+	flushed int64
+}
+
+func newREDAggregator(statusCodes *statusCodes, buckets []float64, maxEndpoints int) *redAggregator {
+	return &redAggregator{
+		statusCodes:  statusCodes,
+		buckets:      buckets,
+		maxEndpoints: maxEndpoints,
+		windows:      make(map[int64]*redWindowData),
+	}
+}
+
+func (a *redAggregator) record(namespace string, data *agentV3.SegmentObject, span *agentV3.SpanObject) {
+	if span.GetSpanType() != agentV3.SpanType_Entry {
+		return
+	}
+
+	start := time.Unix(0, span.GetStartTime()*int64(time.Millisecond)).Truncate(redWindow).UnixNano()
+	duration := float64(span.GetEndTime() - span.GetStartTime())
+	status, _ := a.statusCodes.status(span)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// Recreating a flushed window would emit its series twice.
+	if start <= a.flushed {
+		monitor.LateRecords.WithLabelValues("red").Inc()
+		return
+	}
+
+	window, ok := a.windows[start]
+	if !ok {
+		window = &redWindowData{
+			series:    make(map[redSeries]*redStatistics),
+			endpoints: make(map[redService]map[string]bool),
+		}
+		a.windows[start] = window
+	}
+
+	series := redSeries{
+		namespace:       namespace,
+		service:         data.GetService(),
+		serviceInstance: data.GetServiceInstance(),
+		endpoint:        a.endpointOf(window, namespace, data.GetService(), span.GetOperationName()),
+		kind:            getSpanKind(span),
+		status:          status,
+	}
+	statistics, ok := window.series[series]
+	if !ok {
+		statistics = &redStatistics{buckets: make([]int64, len(a.buckets)+1)}
+		window.series[series] = statistics
+	}
+
+	statistics.calls++
+	statistics.duration += duration
+	for i := sort.SearchFloat64s(a.buckets, duration); i < len(statistics.buckets); i++ {
+		statistics.buckets[i]++
+	}
+}
+
+// endpointOf limits the number of endpoints of a service in a window,
+// endpoints beyond the limit are reported as one, so that high cardinality
+// names such as URLs with ids in the path don't blow up the metrics. The
+// endpoints are forgotten along with the window.
+func (a *redAggregator) endpointOf(window *redWindowData, namespace, service, endpoint string) string {
+	key := redService{namespace: namespace, service: service}
+	endpoints, ok := window.endpoints[key]
+	if !ok {
+		endpoints = make(map[string]bool)
+		window.endpoints[key] = endpoints
+	}
+
+	if endpoints[endpoint] {
+		return endpoint
+	}
+	if a.maxEndpoints > 0 && len(endpoints) >= a.maxEndpoints {
+		return redOtherEndpoint
+	}
+	endpoints[endpoint] = true
+	return endpoint
+}
+
+// Flush emits a window once another window has passed after it closed, so that
+// segments reported late are still counted.
+func (a *redAggregator) Flush(now time.Time, final bool) ([]*sls.LogGroup, modules.DataType) {
+	a.lock.Lock()
+	closed := make(map[int64]*redWindowData)
+	if flushed := now.Add(-2 * redWindow).Truncate(redWindow).UnixNano(); flushed > a.flushed {
+		a.flushed = flushed
+	}
+	for start, window := range a.windows {
+		if final || start <= a.flushed {
+			closed[start] = window
+			delete(a.windows, start)
+		}
+	}
+	a.lock.Unlock()
+
+	if len(closed) == 0 {
+		return nil, modules.METRIC
+	}
+
+	logs := make(map[string][]*sls.Log)
+	for start, window := range closed {
+		for series, statistics := range window.series {
+			logs[series.namespace] = a.convertSeries(start/int64(time.Millisecond), series, statistics, logs[series.namespace])
+		}
+	}
+	return groupByNamespace(logs, "", "0.0.0.0"), modules.METRIC
+}
+
+func (a *redAggregator) convertSeries(timestamp int64, series redSeries, statistics *redStatistics, logs []*sls.Log) []*sls.Log {
+	serviceName := newPair("service", series.service)
+	serviceInstance := newPair("serviceInstance", series.serviceInstance)
+	endpoint := newPair("endpoint", series.endpoint)
+	kind := newPair("kind", series.kind)
+	status := newPair("status", series.status)
+
+	calls := strconv.FormatInt(statistics.calls, 10)
+	logs = append(logs, newMetric("skywalking_endpoint_calls", timestamp, calls, serviceName, serviceInstance, endpoint, kind, status))
+	logs = append(logs, newMetric("skywalking_endpoint_duration_ms_count", timestamp, calls, serviceName, serviceInstance, endpoint, kind, status))
+	logs = append(logs, newMetric("skywalking_endpoint_duration_ms_sum", timestamp, strconv.FormatFloat(statistics.duration, 'f', -1, 64), serviceName, serviceInstance, endpoint, kind, status))
+
+	for i, count := range statistics.buckets {
+		le := "+Inf"
+		if i < len(a.buckets) {
+			le = strconv.FormatFloat(a.buckets[i], 'f', -1, 64)
+		}
+		logs = append(logs, newMetric("skywalking_endpoint_duration_ms_bucket", timestamp, strconv.FormatInt(count, 10), serviceName, serviceInstance, endpoint, kind, status, newPair("le", le)))
+	}
+	return logs
+}
@@ -0,0 +1,249 @@
+package converter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	"gopkg.in/yaml.v2"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+)
+
+const (
+	REDACT_DROP     = "drop"
+	REDACT_HASH     = "hash"
+	REDACT_MASK     = "mask"
+	REDACT_TRUNCATE = "truncate"
+)
+
+const (
+	// RedactionBodyKey the key rules use to match the body of log records
+	RedactionBodyKey = "body"
+	// RedactionPeerKey the key rules use to match the peer of spans
+	RedactionPeerKey = "peer"
+	// RedactionOperationNameKey the key rules use to match the operation name of spans
+	RedactionOperationNameKey = "operation_name"
+	// defaultMaskReplacement replaces the matches of mask rules without a replacement
+	defaultMaskReplacement = "***"
+)
+
+type redactionRule struct {
+	// Keys the keys the rule applies to, every key if empty
+	Keys        []string `yaml:"keys"`
+	Action      string   `yaml:"action"`
+	Pattern     string   `yaml:"pattern"`
+	Replacement string   `yaml:"replacement"`
+	MaxLength   int      `yaml:"max_length"`
+
+	keys    map[string]bool
+	pattern *regexp.Regexp
+}
+
+type redactionRules struct {
+	// HashKey the key of the HMAC of hash rules, or HashKeyFile the file holding it
+	HashKey     string           `yaml:"hash_key"`
+	HashKeyFile string           `yaml:"hash_key_file"`
+	Rules       []*redactionRule `yaml:"rules"`
+	// Services replaces the rules for the listed services
+	Services map[string][]*redactionRule `yaml:"services"`
+}
+
+// redactor scrubs the peers, operation names, tags and logs of spans and the
+// log records before they are converted.
+type redactor struct {
+	hashKey  []byte
+	rules    []*redactionRule
+	services map[string][]*redactionRule
+}
+
+// newRedactor loads the rules of the file, it returns nil if no file is given.
+func newRedactor(file string) (*redactor, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &redactionRules{}
+	if err = yaml.Unmarshal(data, rules); err != nil {
+		return nil, err
+	}
+
+	if err = compileRedactionRules(rules.Rules); err != nil {
+		return nil, err
+	}
+	for service, serviceRules := range rules.Services {
+		if err = compileRedactionRules(serviceRules); err != nil {
+			return nil, fmt.Errorf("rules of service %s: %w", service, err)
+		}
+	}
+
+	hashKey, err := hashKeyOf(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &redactor{hashKey: hashKey, rules: rules.Rules, services: rules.Services}, nil
+}
+
+// hashKeyOf returns the HMAC key of the rules. A key is required once a rule
+// hashes values, since the digests of short values are easily brute-forced.
+func hashKeyOf(rules *redactionRules) ([]byte, error) {
+	if rules.HashKey != "" && rules.HashKeyFile != "" {
+		return nil, errors.New("both hash_key and hash_key_file are set")
+	}
+
+	key := rules.HashKey
+	if rules.HashKeyFile != "" {
+		data, err := ioutil.ReadFile(rules.HashKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		// mounted secrets usually end with a line break
+		key = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if key == "" && hasHashRule(rules) {
+		return nil, errors.New("hash rules require hash_key or hash_key_file")
+	}
+	return []byte(key), nil
+}
+
+func hasHashRule(rules *redactionRules) bool {
+	all := [][]*redactionRule{rules.Rules}
+	for _, serviceRules := range rules.Services {
+		all = append(all, serviceRules)
+	}
+	for _, list := range all {
+		for _, rule := range list {
+			if rule.Action == REDACT_HASH {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compileRedactionRules(rules []*redactionRule) error {
+	for i, rule := range rules {
+		rule.keys = make(map[string]bool)
+		for _, key := range rule.Keys {
+			rule.keys[key] = true
+		}
+
+		switch rule.Action {
+		case REDACT_DROP, REDACT_HASH:
+		case REDACT_MASK:
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("rule %d: %w", i, err)
+			}
+			rule.pattern = pattern
+			if rule.Replacement == "" {
+				rule.Replacement = defaultMaskReplacement
+			}
+		case REDACT_TRUNCATE:
+			if rule.MaxLength <= 0 {
+				return fmt.Errorf("rule %d: max_length should be positive", i)
+			}
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i, rule.Action)
+		}
+	}
+	return nil
+}
+
+func (r *redactor) rulesOf(service string) []*redactionRule {
+	if rules, ok := r.services[service]; ok {
+		return rules
+	}
+	return r.rules
+}
+
+// redact applies the rules to the value, it returns false if the key is dropped.
+func (r *redactor) redact(rules []*redactionRule, key, value string) (string, bool) {
+	for _, rule := range rules {
+		if len(rule.keys) > 0 && !rule.keys[key] {
+			continue
+		}
+
+		switch rule.Action {
+		case REDACT_DROP:
+			monitor.Redactions.WithLabelValues(rule.Action).Inc()
+			return "", false
+		case REDACT_HASH:
+			mac := hmac.New(sha256.New, r.hashKey)
+			mac.Write([]byte(value))
+			value = hex.EncodeToString(mac.Sum(nil))
+		case REDACT_MASK:
+			if !rule.pattern.MatchString(value) {
+				continue
+			}
+			value = rule.pattern.ReplaceAllString(value, rule.Replacement)
+		case REDACT_TRUNCATE:
+			if len(value) <= rule.MaxLength {
+				continue
+			}
+			// Cut at the start of a rune so that the value stays valid UTF-8.
+			end := rule.MaxLength
+			for end > 0 && !utf8.RuneStart(value[end]) {
+				end--
+			}
+			value = value[:end]
+		}
+		monitor.Redactions.WithLabelValues(rule.Action).Inc()
+	}
+	return value, true
+}
+
+func (r *redactor) redactPairs(rules []*redactionRule, pairs []*v3.KeyStringValuePair) []*v3.KeyStringValuePair {
+	redacted := pairs[:0]
+	for _, pair := range pairs {
+		value, ok := r.redact(rules, pair.Key, pair.Value)
+		if !ok {
+			continue
+		}
+		pair.Value = value
+		redacted = append(redacted, pair)
+	}
+	return redacted
+}
+
+// redactSpan redacts the span before it is converted and aggregated, so the
+// attributes derived from the peer are redacted as well.
+func (r *redactor) redactSpan(service string, span *agentV3.SpanObject) {
+	rules := r.rulesOf(service)
+	span.Peer, _ = r.redact(rules, RedactionPeerKey, span.Peer)
+	span.OperationName, _ = r.redact(rules, RedactionOperationNameKey, span.OperationName)
+	span.Tags = r.redactPairs(rules, span.Tags)
+	for _, log := range span.Logs {
+		log.Data = r.redactPairs(rules, log.Data)
+	}
+}
+
+func (r *redactor) redactLog(data *loggingV3.LogData) {
+	rules := r.rulesOf(data.GetService())
+	if tags := data.GetTags(); tags != nil {
+		tags.Data = r.redactPairs(rules, tags.Data)
+	}
+
+	switch content := data.GetBody().GetContent().(type) {
+	case *loggingV3.LogDataBody_Text:
+		content.Text.Text, _ = r.redact(rules, RedactionBodyKey, content.Text.GetText())
+	case *loggingV3.LogDataBody_Json:
+		content.Json.Json, _ = r.redact(rules, RedactionBodyKey, content.Json.GetJson())
+	case *loggingV3.LogDataBody_Yaml:
+		content.Yaml.Yaml, _ = r.redact(rules, RedactionBodyKey, content.Yaml.GetYaml())
+	}
+}
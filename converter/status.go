@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// statusCodes the vocabulary of the status code of spans.
+type statusCodes struct {
+	ok    string
+	error string
+}
+
+func newStatusCodes(config configure.Configuration) *statusCodes {
+	switch config.StatusCodes() {
+	case configure.STATUS_CODES_OTEL:
+		return &statusCodes{ok: "UNSET", error: StatusCodeError}
+	default:
+		return &statusCodes{ok: "SUCCESS", error: StatusCodeError}
+	}
+}
+
+// status returns the status code and message of the span. Spans answering
+// with a HTTP 5xx status are errors even if the agent didn't mark them.
+func (s *statusCodes) status(span *agentV3.SpanObject) (string, string) {
+	if !isErrorSpan(span) {
+		return s.ok, ""
+	}
+
+	if message := getErrorMessage(span); message != "" {
+		return s.error, message
+	}
+	if httpStatus := getHTTPStatusCode(span); httpStatus >= 500 {
+		return s.error, "HTTP " + strconv.Itoa(httpStatus)
+	}
+	return s.error, ""
+}
+
+func isErrorSpan(span *agentV3.SpanObject) bool {
+	return span.GetIsError() || getHTTPStatusCode(span) >= 500
+}
+
+func getHTTPStatusCode(span *agentV3.SpanObject) int {
+	for _, tag := range span.Tags {
+		if tag.Key != "status_code" && tag.Key != "http.status_code" {
+			continue
+		}
+		if code, err := strconv.Atoi(strings.TrimSpace(tag.Value)); err == nil {
+			return code
+		}
+	}
+	return 0
+}
+
+// getErrorMessage formats the first error log of the span as
+// "<error.kind>: <message>", falling back to the stack.
+func getErrorMessage(span *agentV3.SpanObject) string {
+	for _, log := range span.Logs {
+		fields := make(map[string]string)
+		for _, d := range log.Data {
+			fields[d.Key] = d.Value
+		}
+		if fields[SpanLogEvent] != "error" && fields[SpanLogErrorKind] == "" {
+			continue
+		}
+
+		kind, message := fields[SpanLogErrorKind], fields[SpanLogMessage]
+		switch {
+		case kind != "" && message != "":
+			return kind + ": " + message
+		case kind != "":
+			return kind
+		case message != "":
+			return message
+		default:
+			return fields[SpanLogStack]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// STAGE_CONVERT the data failed to convert
+	STAGE_CONVERT = "convert"
+	// STAGE_EXPORT the data failed to export
+	STAGE_EXPORT = "export"
+)
+
+const (
+	HeaderTopic     = "x-original-topic"
+	HeaderPartition = "x-original-partition"
+	HeaderOffset    = "x-original-offset"
+	HeaderStage     = "x-failure-stage"
+	HeaderError     = "x-failure-error"
+)
+
+const (
+	fileName       = "dead-letter.log"
+	fileMaxSizeMB  = 100
+	produceTimeout = 10 * time.Second
+)
+
+// Record is the raw data of a message which failed to convert or export,
+// together with where it was read from and why it failed.
+type Record struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+	Data      []byte    `json:"data"`
+	// Position is where the record is kept in the sink, it is set when the
+	// record is read back
+	Position Position `json:"-"`
+}
+
+// Position is the partition and offset of a record in the dead letter topic,
+// or the index of its file and its line in the file.
+type Position struct {
+	Partition int32
+	Offset    int64
+}
+
+func NewRecord(data modules.OriginData, stage string, err error) *Record {
+	metadata := data.Metadata()
+	return &Record{
+		Topic:     metadata.Topic,
+		Partition: metadata.Partition,
+		Offset:    metadata.Offset,
+		Stage:     stage,
+		Error:     err.Error(),
+		Time:      time.Now(),
+		Data:      data.Data(),
+	}
+}
+
+// Metadata returns where the record was originally read from.
+func (r *Record) Metadata() modules.Metadata {
+	return modules.Metadata{Topic: r.Topic, Partition: r.Partition, Offset: r.Offset}
+}
+
+type Sink interface {
+	Write(*Record) error
+	Close() error
+}
+
+// NewSink returns nil if no dead letter sink is configured.
+func NewSink(config configure.Configuration) (Sink, error) {
+	switch config.DeadLetterType() {
+	case configure.KAFKA_DEAD_LETTER:
+		return newKafkaSink(config)
+	case configure.FILE_DEAD_LETTER:
+		return newFileSink(config)
+	default:
+		return nil, nil
+	}
+}
+
+type kafkaSink struct {
+	producer *kafka.Producer
+	topic    string
+}
+
+func newKafkaSink(config configure.Configuration) (Sink, error) {
+	cm := kafka.ConfigMap{
+		"bootstrap.servers": config.BootstrapServers(),
+	}
+	for k, v := range config.KafkaProperties() {
+		if err := cm.SetKey(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := kafka.NewProducer(&cm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaSink{producer: p, topic: config.DeadLetterTopic()}, nil
+}
+
+// Write blocks until the record is delivered, so that the data is only
+// acknowledged once it is safe in the dead letter topic.
+func (s *kafkaSink) Write(r *Record) error {
+	delivery := make(chan kafka.Event, 1)
+	err := s.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &s.topic, Partition: kafka.PartitionAny},
+		Value:          r.Data,
+		Timestamp:      r.Time,
+		Headers: []kafka.Header{
+			{Key: HeaderTopic, Value: []byte(r.Topic)},
+			{Key: HeaderPartition, Value: []byte(strconv.Itoa(int(r.Partition)))},
+			{Key: HeaderOffset, Value: []byte(strconv.FormatInt(r.Offset, 10))},
+			{Key: HeaderStage, Value: []byte(r.Stage)},
+			{Key: HeaderError, Value: []byte(r.Error)},
+		},
+	}, delivery)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case ev := <-delivery:
+		if m, ok := ev.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			return m.TopicPartition.Error
+		}
+		return nil
+	case <-time.After(produceTimeout):
+		return kafka.NewError(kafka.ErrTimedOut, "dead letter delivery timed out", false)
+	}
+}
+
+func (s *kafkaSink) Close() error {
+	s.producer.Flush(int(produceTimeout / time.Millisecond))
+	s.producer.Close()
+	return nil
+}
+
+// fileSink writes records as JSON lines into rotated files of a directory.
+// Rotated files are never removed, so nothing is lost until it is replayed.
+type fileSink struct {
+	writer *lumberjack.Logger
+}
+
+func newFileSink(config configure.Configuration) (Sink, error) {
+	if err := os.MkdirAll(config.DeadLetterDirectory(), 0755); err != nil {
+		return nil, err
+	}
+
+	return &fileSink{writer: &lumberjack.Logger{
+		Filename: filepath.Join(config.DeadLetterDirectory(), fileName),
+		MaxSize:  fileMaxSizeMB,
+	}}, nil
+}
+
+func (s *fileSink) Write(r *Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,261 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const (
+	replayingSuffix = ".replaying"
+	maxLineSize     = 64 * 1024 * 1024
+	metadataTimeout = 10000
+)
+
+// Reader reads back the records of a dead letter sink. Read returns io.EOF once
+// every record which existed when the reader was created has been read.
+type Reader interface {
+	Read() (*Record, error)
+	// Close marks the records as replayed, replayed maps the partitions of the
+	// positions to the offset of their first record which isn't replayed.
+	// The other records are read again by the next replay.
+	Close(replayed map[int32]int64) error
+}
+
+func NewReader(config configure.Configuration) (Reader, error) {
+	switch config.DeadLetterType() {
+	case configure.KAFKA_DEAD_LETTER:
+		return newKafkaReader(config)
+	default:
+		return newFileReader(config)
+	}
+}
+
+type kafkaReader struct {
+	consumer *kafka.Consumer
+	topic    string
+	// high watermark of each partition which still has records to read
+	remaining map[int32]int64
+}
+
+func newKafkaReader(config configure.Configuration) (Reader, error) {
+	cm := kafka.ConfigMap{
+		"bootstrap.servers":  config.BootstrapServers(),
+		"group.id":           config.GroupID() + "-dead-letter-replay",
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	}
+	for k, v := range config.KafkaProperties() {
+		if err := cm.SetKey(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := kafka.NewConsumer(&cm)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &kafkaReader{consumer: c, topic: config.DeadLetterTopic(), remaining: make(map[int32]int64)}
+	if err = r.assign(config.DeadLetterTopic()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// assign reads every partition of the topic from the last replayed offset up
+// to its current high watermark. Records dead-lettered again while replaying
+// are left for the next replay.
+func (r *kafkaReader) assign(topic string) error {
+	metadata, err := r.consumer.GetMetadata(&topic, false, metadataTimeout)
+	if err != nil {
+		return err
+	}
+
+	partitions := make([]kafka.TopicPartition, 0)
+	for _, p := range metadata.Topics[topic].Partitions {
+		partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: p.ID, Offset: kafka.OffsetStored})
+	}
+
+	committed, err := r.consumer.Committed(partitions, metadataTimeout)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range committed {
+		low, high, err := r.consumer.QueryWatermarkOffsets(topic, p.Partition, metadataTimeout)
+		if err != nil {
+			return err
+		}
+
+		start := low
+		if p.Offset >= 0 && int64(p.Offset) > low {
+			start = int64(p.Offset)
+		}
+		if start < high {
+			r.remaining[p.Partition] = high
+		}
+	}
+
+	return r.consumer.Assign(partitions)
+}
+
+func (r *kafkaReader) Read() (*Record, error) {
+	for len(r.remaining) > 0 {
+		ev := r.consumer.Poll(1000)
+		switch e := ev.(type) {
+		case *kafka.Message:
+			high, ok := r.remaining[e.TopicPartition.Partition]
+			if !ok || int64(e.TopicPartition.Offset) >= high {
+				continue
+			}
+			if int64(e.TopicPartition.Offset)+1 >= high {
+				delete(r.remaining, e.TopicPartition.Partition)
+			}
+			return recordOf(e), nil
+		case kafka.Error:
+			return nil, e
+		}
+	}
+	return nil, io.EOF
+}
+
+func recordOf(message *kafka.Message) *Record {
+	r := &Record{Time: message.Timestamp, Data: message.Value,
+		Position: Position{Partition: message.TopicPartition.Partition, Offset: int64(message.TopicPartition.Offset)}}
+	for _, h := range message.Headers {
+		switch h.Key {
+		case HeaderTopic:
+			r.Topic = string(h.Value)
+		case HeaderPartition:
+			p, _ := strconv.Atoi(string(h.Value))
+			r.Partition = int32(p)
+		case HeaderOffset:
+			r.Offset, _ = strconv.ParseInt(string(h.Value), 10, 64)
+		case HeaderStage:
+			r.Stage = string(h.Value)
+		case HeaderError:
+			r.Error = string(h.Value)
+		}
+	}
+	return r
+}
+
+func (r *kafkaReader) Close(replayed map[int32]int64) error {
+	offsets := make([]kafka.TopicPartition, 0, len(replayed))
+	for partition, offset := range replayed {
+		offsets = append(offsets, kafka.TopicPartition{Topic: &r.topic, Partition: partition, Offset: kafka.Offset(offset)})
+	}
+	if len(offsets) > 0 {
+		if _, err := r.consumer.CommitOffsets(offsets); err != nil {
+			r.consumer.Close()
+			return err
+		}
+	}
+	return r.consumer.Close()
+}
+
+// fileReader replays the files of a file sink. The files are renamed before
+// they are read, so that records dead-lettered again go to new files, and are
+// removed once every record of them has been replayed.
+type fileReader struct {
+	files   []string
+	current *os.File
+	scanner *bufio.Scanner
+	read    int
+	// line of the current file, and the line count of the files read
+	line  int64
+	lines []int64
+}
+
+func newFileReader(config configure.Configuration) (Reader, error) {
+	dir := config.DeadLetterDirectory()
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, name := range names {
+		base := filepath.Base(name)
+		if !strings.HasPrefix(base, strings.TrimSuffix(fileName, ".log")) {
+			continue
+		}
+
+		if !strings.HasSuffix(name, replayingSuffix) {
+			if err := os.Rename(name, name+replayingSuffix); err != nil {
+				return nil, err
+			}
+			name += replayingSuffix
+		}
+		files = append(files, name)
+	}
+
+	// Rotated files are named after their rotation time, so that they sort
+	// before the file which was being written.
+	sort.Strings(files)
+	return &fileReader{files: files}, nil
+}
+
+func (r *fileReader) Read() (*Record, error) {
+	for {
+		if r.scanner == nil {
+			if r.read == len(r.files) {
+				return nil, io.EOF
+			}
+
+			f, err := os.Open(r.files[r.read])
+			if err != nil {
+				return nil, err
+			}
+			r.current = f
+			r.scanner = bufio.NewScanner(f)
+			r.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		}
+
+		if r.scanner.Scan() {
+			record := &Record{}
+			if err := json.Unmarshal(r.scanner.Bytes(), record); err != nil {
+				return nil, err
+			}
+			record.Position = Position{Partition: int32(r.read), Offset: r.line}
+			r.line++
+			return record, nil
+		}
+
+		err := r.scanner.Err()
+		r.current.Close()
+		r.current, r.scanner = nil, nil
+		if err != nil {
+			return nil, err
+		}
+		r.lines = append(r.lines, r.line)
+		r.line = 0
+		r.read++
+	}
+}
+
+func (r *fileReader) Close(replayed map[int32]int64) error {
+	if r.current != nil {
+		r.current.Close()
+	}
+
+	for i, name := range r.files[:r.read] {
+		if replayed[int32(i)] < r.lines[i] {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+)
+
+var errExporterClosed = errors.New("exporter is closed")
+
+// batchKey identifies the LogGroups that can be merged into one PutLogs call.
+type batchKey struct {
+	sender    *exporterImpl
+	namespace string
+	logstore  string
+	topic     string
+	source    string
+}
+
+type batch struct {
+	key       batchKey
+	group     *sls.LogGroup
+	bytes     int
+	created   time.Time
+	callbacks []*pendingCallback
+}
+
+// pendingCallback fires the callback of an Export call once every batch holding
+// a part of its data has been sent, with the error of any batch which failed.
+type pendingCallback struct {
+	remaining int32
+	callback  Callback
+	err       atomic.Value
+}
+
+func (p *pendingCallback) done(err error) {
+	if err != nil {
+		// atomic.Value requires the same concrete type on every store
+		p.err.Store(struct{ error }{err})
+	}
+
+	if atomic.AddInt32(&p.remaining, -1) == 0 && p.callback != nil {
+		if failure, ok := p.err.Load().(struct{ error }); ok {
+			p.callback(failure.error)
+		} else {
+			p.callback(nil)
+		}
+	}
+}
+
+// batchExporter buffers logs per destination, namespace, logstore, Topic and
+// Source and sends them in one PutLogs call once the log count, byte size or
+// linger time is reached.
+type batchExporter struct {
+	router   *router
+	maxLogs  int
+	maxBytes int
+	linger   time.Duration
+
+	lock     sync.Mutex
+	batches  map[batchKey]*batch
+	closed   bool
+	stop     chan struct{}
+	inflight sync.WaitGroup
+}
+
+func newBatchExporter(config configure.Configuration, router *router) *batchExporter {
+	e := &batchExporter{
+		router:   router,
+		maxLogs:  config.BatchMaxLogs(),
+		maxBytes: config.BatchMaxBytes(),
+		linger:   config.BatchLinger(),
+		batches:  make(map[batchKey]*batch),
+		stop:     make(chan struct{}),
+	}
+
+	go e.flushExpired()
+	return e
+}
+
+func (e *batchExporter) Export(t modules.DataType, data *sls.LogGroup, callback Callback) error {
+	if data == nil || len(data.Logs) == 0 {
+		if callback != nil {
+			callback(nil)
+		}
+		return nil
+	}
+
+	namespace := modules.NamespaceOf(data)
+	routes := e.router.route(namespace, t, data.Logs)
+	pending := &pendingCallback{remaining: 1, callback: callback}
+	full := make([]*batch, 0)
+
+	e.lock.Lock()
+	if e.closed {
+		e.lock.Unlock()
+		return errExporterClosed
+	}
+
+	for _, r := range routes {
+		logstore := r.sender.logstoreOf(t)
+		if logstore == "" {
+			continue
+		}
+		key := batchKey{sender: r.sender, namespace: namespace, logstore: logstore, topic: data.GetTopic(), source: data.GetSource()}
+		full = e.append(key, r.logs, pending, full)
+	}
+	e.inflight.Add(len(full))
+	e.lock.Unlock()
+
+	for _, b := range full {
+		e.send(b)
+	}
+	pending.done(nil)
+	return nil
+}
+
+// append adds the logs to the batches of the key and returns the full batches
+// detached. The caller must hold the lock.
+func (e *batchExporter) append(key batchKey, logs []*sls.Log, pending *pendingCallback, full []*batch) []*batch {
+	var b *batch
+	for _, log := range logs {
+		if b == nil {
+			b = e.batchOf(key, pending)
+		}
+
+		size := encodedSize(log)
+		if len(b.group.Logs) > 0 && b.bytes+size > e.maxBytes {
+			full = append(full, b)
+			delete(e.batches, key)
+			b = e.batchOf(key, pending)
+		}
+
+		b.group.Logs = append(b.group.Logs, log)
+		b.bytes += size
+
+		if len(b.group.Logs) >= e.maxLogs {
+			full = append(full, b)
+			delete(e.batches, key)
+			b = nil
+		}
+	}
+	return full
+}
+
+// encodedSize returns the bytes of a log encoded in a LogGroup, including its
+// field key and length.
+func encodedSize(log *sls.Log) int {
+	size := log.Size()
+	return 1 + proto.SizeVarint(uint64(size)) + size
+}
+
+func (e *batchExporter) Close() error {
+	e.lock.Lock()
+	if e.closed {
+		e.lock.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.stop)
+	remaining := e.detach(func(b *batch) bool { return true })
+	e.lock.Unlock()
+
+	for _, b := range remaining {
+		e.send(b)
+	}
+	e.inflight.Wait()
+	return nil
+}
+
+// batchOf returns the open batch of the key, creating it if needed, and
+// registers the callback on it.
+// The caller must hold the lock.
+func (e *batchExporter) batchOf(key batchKey, pending *pendingCallback) *batch {
+	b, ok := e.batches[key]
+	if !ok {
+		b = &batch{
+			key: key,
+			group: &sls.LogGroup{
+				Topic:  proto.String(key.topic),
+				Source: proto.String(key.source),
+			},
+			created: time.Now(),
+		}
+		modules.SetNamespace(b.group, key.namespace)
+		// the Topic, Source and tags are sent along with the logs
+		b.bytes = b.group.Size()
+		e.batches[key] = b
+	}
+
+	atomic.AddInt32(&pending.remaining, 1)
+	b.callbacks = append(b.callbacks, pending)
+	return b
+}
+
+func (e *batchExporter) flushExpired() {
+	interval := e.linger / 2
+	if interval <= 0 {
+		interval = e.linger
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+
+		e.lock.Lock()
+		expired := e.detach(func(b *batch) bool { return time.Since(b.created) >= e.linger })
+		e.lock.Unlock()
+
+		for _, b := range expired {
+			e.send(b)
+		}
+	}
+}
+
+// detach removes the matching batches so that they can be sent without holding
+// the lock. The caller must hold the lock.
+func (e *batchExporter) detach(match func(*batch) bool) []*batch {
+	detached := make([]*batch, 0)
+	for key, b := range e.batches {
+		if match(b) {
+			detached = append(detached, b)
+			delete(e.batches, key)
+		}
+	}
+	e.inflight.Add(len(detached))
+	return detached
+}
+
+func (e *batchExporter) send(b *batch) {
+	defer e.inflight.Done()
+
+	monitor.BatchSize.WithLabelValues(b.key.logstore).Observe(float64(len(b.group.Logs)))
+	err := b.key.sender.send(b.key.logstore, b.group)
+	for _, c := range b.callbacks {
+		c.done(err)
+	}
+}
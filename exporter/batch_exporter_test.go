@@ -0,0 +1,291 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+)
+
+type testConfiguration struct {
+	configure.Configuration
+	maxLogs  int
+	maxBytes int
+	linger   time.Duration
+}
+
+func (c *testConfiguration) BatchMaxLogs() int                     { return c.maxLogs }
+func (c *testConfiguration) BatchMaxBytes() int                    { return c.maxBytes }
+func (c *testConfiguration) BatchLinger() time.Duration            { return c.linger }
+func (c *testConfiguration) ExportMaxRetries() int                 { return 1 }
+func (c *testConfiguration) Routing() configure.Routing            { return configure.Routing{} }
+func (c *testConfiguration) Destinations() []configure.Destination { return nil }
+
+type putLogsCall struct {
+	logstore string
+	group    *sls.LogGroup
+}
+
+// failValue marks the logs failing the PutLogs calls carrying them.
+const failValue = "fail"
+
+// fakeClient records the successful PutLogs calls.
+type fakeClient struct {
+	sls.ClientInterface
+	lock  sync.Mutex
+	calls []putLogsCall
+}
+
+func (c *fakeClient) PutLogs(project, logstore string, lg *sls.LogGroup) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, log := range lg.Logs {
+		if log.Contents[0].GetValue() == failValue {
+			return errors.New("put logs failed")
+		}
+	}
+	c.calls = append(c.calls, putLogsCall{logstore: logstore, group: lg})
+	return nil
+}
+
+func (c *fakeClient) sent() []putLogsCall {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]putLogsCall(nil), c.calls...)
+}
+
+func newTestBatchExporter(config *testConfiguration, client *fakeClient, namespaces ...string) *batchExporter {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	senders := make([]*exporterImpl, 0, len(namespaces))
+	for _, ns := range namespaces {
+		senders = append(senders, &exporterImpl{
+			logger:     zap.NewNop(),
+			maxRetries: config.ExportMaxRetries(),
+			client:     client,
+			destination: configure.Destination{
+				Namespace:       ns,
+				TracesLogstore:  ns + "traces",
+				MetricsLogstore: ns + "metrics",
+			},
+		})
+	}
+	return newBatchExporter(config, newRouter(senders, map[string]*exporterImpl{}, config.Routing()))
+}
+
+func newTestGroup(topic string, count int, size int) *sls.LogGroup {
+	group := &sls.LogGroup{Topic: proto.String(topic), Source: proto.String("0.0.0.0")}
+	for i := 0; i < count; i++ {
+		group.Logs = append(group.Logs, &sls.Log{Time: proto.Uint32(0), Contents: []*sls.LogContent{
+			{Key: proto.String("k"), Value: proto.String(fmt.Sprintf("%0*d", size, i))},
+		}})
+	}
+	return group
+}
+
+// callbackRecorder counts the callbacks of an Export call.
+type callbackRecorder struct {
+	lock  sync.Mutex
+	calls int
+	err   error
+}
+
+func (r *callbackRecorder) callback(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls++
+	r.err = err
+}
+
+func (r *callbackRecorder) result() (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.calls, r.err
+}
+
+func logCounts(calls []putLogsCall) []int {
+	counts := make([]int, 0, len(calls))
+	for _, c := range calls {
+		counts = append(counts, len(c.group.Logs))
+	}
+	return counts
+}
+
+func TestBatchExporterMaxLogs(t *testing.T) {
+	client := &fakeClient{}
+	e := newTestBatchExporter(&testConfiguration{maxLogs: 2, maxBytes: configure.MAX_BATCH_BYTES, linger: time.Hour}, client)
+
+	recorder := &callbackRecorder{}
+	if err := e.Export(modules.TRACE, newTestGroup("", 5, 1), recorder.callback); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[2 2]" {
+		t.Errorf("sent before Close() = %v, want [2 2]", counts)
+	}
+	if calls, _ := recorder.result(); calls != 0 {
+		t.Errorf("callback called %d times before the last log was sent", calls)
+	}
+
+	e.Close()
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[2 2 1]" {
+		t.Errorf("sent after Close() = %v, want [2 2 1]", counts)
+	}
+	if calls, err := recorder.result(); calls != 1 || err != nil {
+		t.Errorf("callback = %d calls with %v, want 1 call with nil", calls, err)
+	}
+}
+
+func TestBatchExporterMaxBytes(t *testing.T) {
+	client := &fakeClient{}
+	// a group of two logs fits, with the group overhead
+	maxBytes := newTestGroup("", 2, 100).Size()
+	e := newTestBatchExporter(&testConfiguration{maxLogs: configure.MAX_BATCH_LOGS, maxBytes: maxBytes, linger: time.Hour}, client)
+
+	if err := e.Export(modules.TRACE, newTestGroup("", 3, 100), nil); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[2]" {
+		t.Errorf("sent before Close() = %v, want [2]", counts)
+	}
+
+	e.Close()
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[2 1]" {
+		t.Errorf("sent after Close() = %v, want [2 1]", counts)
+	}
+}
+
+func TestBatchExporterEncodedSize(t *testing.T) {
+	client := &fakeClient{}
+	maxBytes := 4096
+	e := newTestBatchExporter(&testConfiguration{maxLogs: configure.MAX_BATCH_LOGS, maxBytes: maxBytes, linger: time.Hour}, client, "dev")
+
+	// the logs of 200 bytes need 2 bytes of length, the namespace tag is sent
+	// with every batch
+	group := newTestGroup("topic", 100, 190)
+	modules.SetNamespace(group, "dev")
+	if err := e.Export(modules.TRACE, group, nil); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	e.Close()
+
+	logs := 0
+	sent := client.sent()
+	for i, c := range sent {
+		logs += len(c.group.Logs)
+		size := c.group.Size()
+		if size > maxBytes {
+			t.Errorf("sent a LogGroup of %d bytes, want at most %d", size, maxBytes)
+		}
+		// every batch but the last one is full
+		if i < len(sent)-1 && size+encodedSize(c.group.Logs[0]) <= maxBytes {
+			t.Errorf("sent a LogGroup of %d bytes which had room for another log", size)
+		}
+	}
+	if logs != 100 {
+		t.Errorf("sent %d logs, want 100", logs)
+	}
+}
+
+func TestBatchExporterLinger(t *testing.T) {
+	client := &fakeClient{}
+	e := newTestBatchExporter(&testConfiguration{maxLogs: configure.MAX_BATCH_LOGS, maxBytes: configure.MAX_BATCH_BYTES, linger: 20 * time.Millisecond}, client)
+	defer e.Close()
+
+	recorder := &callbackRecorder{}
+	if err := e.Export(modules.TRACE, newTestGroup("", 1, 1), recorder.callback); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(client.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[1]" {
+		t.Errorf("sent after the linger time = %v, want [1]", counts)
+	}
+	if calls, err := recorder.result(); calls != 1 || err != nil {
+		t.Errorf("callback = %d calls with %v, want 1 call with nil", calls, err)
+	}
+}
+
+func TestBatchExporterKey(t *testing.T) {
+	client := &fakeClient{}
+	e := newTestBatchExporter(&testConfiguration{maxLogs: configure.MAX_BATCH_LOGS, maxBytes: configure.MAX_BATCH_BYTES, linger: time.Hour}, client, "dev", "prod")
+
+	prod := newTestGroup("a", 1, 1)
+	modules.SetNamespace(prod, "prod")
+	groups := []struct {
+		t     modules.DataType
+		group *sls.LogGroup
+	}{
+		{modules.TRACE, newTestGroup("a", 1, 1)},
+		{modules.TRACE, newTestGroup("a", 2, 1)},
+		{modules.TRACE, newTestGroup("b", 1, 1)},
+		{modules.METRIC, newTestGroup("a", 1, 1)},
+		{modules.TRACE, prod},
+		// dev has no logs logstore
+		{modules.LOGGING, newTestGroup("a", 1, 1)},
+	}
+	for _, g := range groups {
+		if err := e.Export(g.t, g.group, nil); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+	}
+	e.Close()
+
+	got := make(map[string]int)
+	for _, c := range client.sent() {
+		got[fmt.Sprintf("%s/%s/%s", c.logstore, c.group.GetTopic(), modules.NamespaceOf(c.group))] = len(c.group.Logs)
+	}
+	// the data of unknown namespaces goes to the first namespace, keeping its tag
+	want := map[string]int{"devtraces/a/": 3, "devtraces/b/": 1, "devmetrics/a/": 1, "prodtraces/a/prod": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("sent = %v, want %v", got, want)
+	}
+}
+
+func TestBatchExporterCallbacks(t *testing.T) {
+	client := &fakeClient{}
+	e := newTestBatchExporter(&testConfiguration{maxLogs: 2, maxBytes: configure.MAX_BATCH_BYTES, linger: time.Hour}, client)
+
+	// a is split into a full batch which succeeds and a batch which fails, b
+	// shares the failing batch, c is in a batch of another topic
+	a := newTestGroup("", 3, 1)
+	a.Logs[2].Contents[0].Value = proto.String(failValue)
+	recorders := []*callbackRecorder{{}, {}, {}}
+	for i, group := range []*sls.LogGroup{a, newTestGroup("", 1, 1), newTestGroup("c", 1, 1)} {
+		if err := e.Export(modules.TRACE, group, recorders[i].callback); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if calls, _ := recorders[0].result(); i == 0 && calls != 0 {
+			t.Errorf("callback of a called %d times before its last batch was sent", calls)
+		}
+	}
+	e.Close()
+
+	for i, wantErr := range []bool{true, true, false} {
+		if calls, err := recorders[i].result(); calls != 1 || (err != nil) != wantErr {
+			t.Errorf("callback %d = %d calls with %v, want 1 call, error %v", i, calls, err, wantErr)
+		}
+	}
+	if counts := logCounts(client.sent()); fmt.Sprint(counts) != "[2 1]" {
+		t.Errorf("sent = %v, want [2 1]", counts)
+	}
+
+	recorder := &callbackRecorder{}
+	if err := e.Export(modules.TRACE, newTestGroup("", 1, 1), recorder.callback); err != errExporterClosed {
+		t.Errorf("Export() after Close() error = %v, want %v", err, errExporterClosed)
+	}
+	if calls, _ := recorder.result(); calls != 0 {
+		t.Errorf("callback called %d times after Close()", calls)
+	}
+}
@@ -1,47 +1,119 @@
 package exporter
 
 import (
-	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/aliyun-sls/skywalking-ingester/configure"
 	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
 	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"go.uber.org/zap"
 )
 
+const (
+	sendInitialBackoff = 100 * time.Millisecond
+	sendMaxBackoff     = 30 * time.Second
+)
+
+// Callback is invoked once the exported data has been written to SLS, or with
+// the error once it has been given up.
+type Callback func(error)
+
 type Exporter interface {
-	Export(modules.DataType, *sls.LogGroup) error
+	Export(modules.DataType, *sls.LogGroup, Callback) error
+	// Close flushes the buffered data and waits until it has been sent.
+	Close() error
+}
+
+// NewExporter creates a sender per destination. The data is exported to the
+// destination of the namespace its LogGroup is tagged with, unless routes are
+// set.
+func NewExporter(config configure.Configuration, logger *zap.Logger) (Exporter, error) {
+	namespaces := make([]*exporterImpl, 0)
+	for _, d := range config.Destinations() {
+		namespaces = append(namespaces, newSender(config, logger, d))
+	}
+
+	routing := config.Routing()
+	named := make(map[string]*exporterImpl)
+	for _, d := range routing.Destinations {
+		named[d.Name] = newSender(config, logger, d)
+	}
+
+	return newBatchExporter(config, newRouter(namespaces, named, routing)), nil
 }
 
-func NewExporter(config configure.Configuration) (Exporter, error) {
+func newSender(config configure.Configuration, logger *zap.Logger, d configure.Destination) *exporterImpl {
 	return &exporterImpl{
+		logger:     logger.With(zap.String("namespace", d.Namespace), zap.String("destination", d.Name), zap.String("project", d.Project)),
+		maxRetries: config.ExportMaxRetries(),
 		client: &sls.Client{
-			Endpoint:        config.Endpoint(),
-			AccessKeyID:     config.AccessKey(),
-			AccessKeySecret: config.AccessSecurityKey(),
+			Endpoint:        d.Endpoint,
+			AccessKeyID:     d.AccessKey,
+			AccessKeySecret: d.AccessSecurityKey,
 		},
-		project:        config.Project(),
-		logstore:       fmt.Sprintf("%s-traces", config.TraceInstance()),
-		metricLogstore: fmt.Sprintf("%s-metrics", config.TraceInstance()),
-	}, nil
+		destination: d,
+	}
 }
 
 type exporterImpl struct {
-	client         *sls.Client
-	project        string
-	logstore       string
-	metricLogstore string
+	logger      *zap.Logger
+	maxRetries  int
+	client      sls.ClientInterface
+	destination configure.Destination
 }
 
-func (e *exporterImpl) Export(t modules.DataType, data *sls.LogGroup) error {
-	if data == nil {
-		return nil
-	}
-	switch t {
-	case modules.TRACE:
-		return e.client.PutLogs(e.project, e.logstore, data)
-	case modules.METRIC:
-		return e.client.PutLogs(e.project, e.metricLogstore, data)
+func (e *exporterImpl) logstoreOf(t modules.DataType) string {
+	return e.destination.Logstore(t.String())
+}
+
+// send blocks until the data is written, so that nothing is acknowledged
+// before it reaches SLS. Retryable errors are retried forever unless a max
+// retry count is set, the others are returned right away.
+func (e *exporterImpl) send(logstore string, data *sls.LogGroup) error {
+	backoff := sendInitialBackoff
+	for retries := 0; ; retries++ {
+		start := time.Now()
+		err := e.client.PutLogs(e.destination.Project, logstore, data)
+		monitor.PutLogsLatency.WithLabelValues(logstore).Observe(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+		monitor.PutLogsErrors.WithLabelValues(logstore).Inc()
+
+		if !retryable(err) {
+			e.logger.Error("Failed to export data, not retryable", zap.String("logstore", logstore), zap.Error(err))
+			return err
+		}
+
+		if e.maxRetries > 0 && retries >= e.maxRetries {
+			e.logger.Error("Failed to export data, giving up", zap.String("logstore", logstore), zap.Int("retries", retries), zap.Error(err))
+			return err
+		}
+
+		e.logger.Warn("Failed to export data, retrying", zap.String("logstore", logstore), zap.Duration("backoff", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > sendMaxBackoff {
+			backoff = sendMaxBackoff
+		}
 	}
+}
 
-	return nil
+// retryable reports whether a PutLogs error may succeed later: network
+// errors, throttling and server errors. Errors such as a missing project or
+// logstore, an authentication failure or a body too large never do.
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *sls.Error:
+		switch e.Code {
+		case sls.WRITE_QUOTA_EXCEED, sls.SHARD_WRITE_QUOTA_EXCEED, sls.PROJECT_QUOTA_EXCEED, sls.SERVER_BUSY, sls.INTERNAL_SERVER_ERROR:
+			return true
+		}
+		// the client errors of the SDK have no HTTP code
+		return e.HTTPCode <= 0 || e.HTTPCode == http.StatusTooManyRequests || e.HTTPCode >= http.StatusInternalServerError
+	case *sls.BadResponseError:
+		return e.HTTPCode == http.StatusTooManyRequests || e.HTTPCode >= http.StatusInternalServerError
+	}
+	return true
 }
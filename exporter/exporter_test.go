@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"go.uber.org/zap"
+)
+
+// errorClient fails the PutLogs calls with its errors in order, then succeeds.
+type errorClient struct {
+	sls.ClientInterface
+	errors []error
+	calls  int
+}
+
+func (c *errorClient) PutLogs(project, logstore string, lg *sls.LogGroup) error {
+	c.calls++
+	if len(c.errors) == 0 {
+		return nil
+	}
+	err := c.errors[0]
+	c.errors = c.errors[1:]
+	return err
+}
+
+func TestSendRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "network error",
+			err:       sls.NewClientError(errors.New("connection reset by peer")),
+			wantCalls: 2,
+		},
+		{
+			name:      "write quota exceeded",
+			err:       &sls.Error{HTTPCode: http.StatusForbidden, Code: sls.WRITE_QUOTA_EXCEED},
+			wantCalls: 2,
+		},
+		{
+			name:      "server error",
+			err:       &sls.Error{HTTPCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"},
+			wantCalls: 2,
+		},
+		{
+			name:      "bad response",
+			err:       sls.NewBadResponseError("", nil, http.StatusBadGateway),
+			wantCalls: 2,
+		},
+		{
+			name:      "logstore not exist",
+			err:       &sls.Error{HTTPCode: http.StatusNotFound, Code: sls.LOGSTORE_NOT_EXIST},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "unauthorized",
+			err:       &sls.Error{HTTPCode: http.StatusUnauthorized, Code: sls.UN_AUTHORIZED},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "body too large",
+			err:       &sls.Error{HTTPCode: http.StatusRequestEntityTooLarge, Code: sls.POST_BODY_TOO_LARGE},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &errorClient{errors: []error{tt.err}}
+			// retries forever unless the error is not retryable
+			e := &exporterImpl{logger: zap.NewNop(), client: client, destination: configure.Destination{Project: "p"}}
+
+			err := e.send("traces", newTestGroup("", 1, 1))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("send() error = %v, want error %v", err, tt.wantErr)
+			}
+			if client.calls != tt.wantCalls {
+				t.Errorf("PutLogs() called %d times, want %d", client.calls, tt.wantCalls)
+			}
+		})
+	}
+}
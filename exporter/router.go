@@ -0,0 +1,219 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/converter"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+)
+
+// resourceServiceInstance is the key of the service instance in the resource
+// of the spans.
+const resourceServiceInstance = "service.instance.id"
+
+// routedLogs are the logs of a LogGroup sent by one sender.
+type routedLogs struct {
+	sender *exporterImpl
+	logs   []*sls.Log
+}
+
+// router selects the senders of the logs. Without routes, the logs are sent to
+// the destination of their namespace.
+type router struct {
+	// namespaces are the senders of the namespaces, the fallback sends the
+	// data of unknown namespaces
+	namespaces map[string]*exporterImpl
+	fallback   *exporterImpl
+	// named are the senders of the routing destinations
+	named    map[string]*exporterImpl
+	routes   []configure.Route
+	defaults []string
+}
+
+func newRouter(namespaces []*exporterImpl, named map[string]*exporterImpl, routing configure.Routing) *router {
+	r := &router{
+		namespaces: make(map[string]*exporterImpl),
+		fallback:   namespaces[0],
+		named:      named,
+		routes:     routing.Routes,
+		defaults:   routing.Default,
+	}
+
+	for _, sender := range namespaces {
+		r.namespaces[sender.destination.Namespace] = sender
+	}
+
+	if len(r.defaults) == 0 {
+		r.defaults = []string{configure.DEFAULT_DESTINATION}
+	}
+	return r
+}
+
+// route groups the logs by their senders, a log routed to several
+// destinations is shared by their groups.
+func (r *router) route(namespace string, t modules.DataType, logs []*sls.Log) []routedLogs {
+	if len(r.routes) == 0 && len(r.defaults) == 1 && r.defaults[0] == configure.DEFAULT_DESTINATION {
+		return []routedLogs{{sender: r.senderOf(namespace), logs: logs}}
+	}
+
+	routed := make([]routedLogs, 0)
+	indexes := make(map[*exporterImpl]int)
+	for _, log := range logs {
+		for _, sender := range r.sendersOf(namespace, t, log) {
+			i, ok := indexes[sender]
+			if !ok {
+				i = len(routed)
+				indexes[sender] = i
+				routed = append(routed, routedLogs{sender: sender})
+			}
+			routed[i].logs = append(routed[i].logs, log)
+		}
+	}
+	return routed
+}
+
+// sendersOf returns the senders of the destinations of the first route
+// matching the log, or of the default destinations.
+func (r *router) sendersOf(namespace string, t modules.DataType, log *sls.Log) []*exporterImpl {
+	names := r.defaults
+	record := newRecord(t, log)
+	for i := range r.routes {
+		if record.matches(&r.routes[i]) {
+			names = r.routes[i].Destinations
+			break
+		}
+	}
+
+	senders := make([]*exporterImpl, 0, len(names))
+	for _, name := range names {
+		sender := r.named[name]
+		if name == configure.DEFAULT_DESTINATION {
+			sender = r.senderOf(namespace)
+		}
+		if sender != nil && !containsSender(senders, sender) {
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
+
+func (r *router) senderOf(namespace string) *exporterImpl {
+	if sender, ok := r.namespaces[namespace]; ok {
+		return sender
+	}
+	return r.fallback
+}
+
+func containsSender(senders []*exporterImpl, sender *exporterImpl) bool {
+	for _, s := range senders {
+		if s == sender {
+			return true
+		}
+	}
+	return false
+}
+
+// record reads the fields matched by the routes from an exported log. The
+// labels and the attributes are decoded on first use.
+type record struct {
+	t          modules.DataType
+	contents   map[string]string
+	labels     map[string]string
+	attributes map[string]string
+}
+
+func newRecord(t modules.DataType, log *sls.Log) *record {
+	contents := make(map[string]string, len(log.Contents))
+	for _, c := range log.Contents {
+		contents[c.GetKey()] = c.GetValue()
+	}
+	return &record{t: t, contents: contents}
+}
+
+func (r *record) matches(route *configure.Route) bool {
+	if len(route.Types) > 0 && !route.Types[r.t.String()] {
+		return false
+	}
+	if route.Service != nil && !route.Service.MatchString(r.service()) {
+		return false
+	}
+	if route.Instance != "" && route.Instance != r.instance() {
+		return false
+	}
+	for k, v := range route.Attributes {
+		if value, ok := r.attributesOf()[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *record) service() string {
+	switch r.t {
+	case modules.METRIC:
+		return r.labelsOf()["service"]
+	case modules.DEPENDENCY:
+		return r.contents[converter.ChildService]
+	default:
+		return r.contents[converter.ServiceName]
+	}
+}
+
+func (r *record) instance() string {
+	switch r.t {
+	case modules.TRACE:
+		return decodeAttributes(r.contents[converter.Resource])[resourceServiceInstance]
+	case modules.METRIC:
+		return r.labelsOf()["serviceInstance"]
+	case modules.LOGGING:
+		return r.contents[converter.LogServiceInstance]
+	default:
+		return ""
+	}
+}
+
+// attributesOf returns the span attributes, the log tags, the metric labels or
+// the dependency fields.
+func (r *record) attributesOf() map[string]string {
+	if r.attributes != nil {
+		return r.attributes
+	}
+
+	switch r.t {
+	case modules.TRACE:
+		r.attributes = decodeAttributes(r.contents[converter.Attribute])
+	case modules.LOGGING:
+		r.attributes = decodeAttributes(r.contents[converter.LogTags])
+	case modules.METRIC:
+		r.attributes = r.labelsOf()
+	default:
+		r.attributes = r.contents
+	}
+	return r.attributes
+}
+
+// labelsOf decodes the labels of a metric, formatted as k#$#v|k#$#v.
+func (r *record) labelsOf() map[string]string {
+	if r.labels != nil {
+		return r.labels
+	}
+
+	r.labels = make(map[string]string)
+	for _, label := range strings.Split(r.contents["__labels__"], "|") {
+		if kv := strings.SplitN(label, "#$#", 2); len(kv) == 2 {
+			r.labels[kv[0]] = kv[1]
+		}
+	}
+	return r.labels
+}
+
+func decodeAttributes(value string) map[string]string {
+	attributes := make(map[string]string)
+	if value != "" {
+		_ = json.Unmarshal([]byte(value), &attributes)
+	}
+	return attributes
+}
@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+)
+
+func newTestLog(contents map[string]string) *sls.Log {
+	log := &sls.Log{Time: proto.Uint32(0)}
+	for k, v := range contents {
+		log.Contents = append(log.Contents, &sls.LogContent{Key: proto.String(k), Value: proto.String(v)})
+	}
+	return log
+}
+
+func TestRouter(t *testing.T) {
+	dev := &exporterImpl{destination: configure.Destination{Namespace: "dev"}}
+	prod := &exporterImpl{destination: configure.Destination{Namespace: "prod"}}
+	payments := &exporterImpl{destination: configure.Destination{Name: "payments"}}
+	tenant := &exporterImpl{destination: configure.Destination{Name: "tenant"}}
+
+	r := newRouter([]*exporterImpl{dev, prod}, map[string]*exporterImpl{"payments": payments, "tenant": tenant}, configure.Routing{
+		Routes: []configure.Route{
+			{Types: map[string]bool{"trace": true}, Service: regexp.MustCompile("^payment-"), Destinations: []string{"payments"}},
+			{Attributes: map[string]string{"tenant": "x"}, Destinations: []string{"tenant", configure.DEFAULT_DESTINATION, "tenant"}},
+			{Instance: "order-1", Destinations: []string{"payments"}},
+		},
+	})
+
+	payment := newTestLog(map[string]string{"service": "payment-api", "attribute": `{"tenant":"x"}`})
+	tagged := newTestLog(map[string]string{"service": "order", "attribute": `{"tenant":"x"}`})
+	order := newTestLog(map[string]string{"service": "order", "attribute": "{}", "resource": `{"service.instance.id":"order-2"}`})
+	instance := newTestLog(map[string]string{"service": "order", "attribute": "{}", "resource": `{"service.instance.id":"order-1"}`})
+	metric := newTestLog(map[string]string{"__labels__": "service#$#payment-api|serviceInstance#$#payment-1|tenant#$#y"})
+
+	tests := []struct {
+		name      string
+		namespace string
+		dataType  modules.DataType
+		logs      []*sls.Log
+		want      map[*exporterImpl][]*sls.Log
+	}{
+		{"service", "prod", modules.TRACE, []*sls.Log{payment, order}, map[*exporterImpl][]*sls.Log{payments: {payment}, prod: {order}}},
+		{"attribute fan-out", "prod", modules.TRACE, []*sls.Log{tagged}, map[*exporterImpl][]*sls.Log{tenant: {tagged}, prod: {tagged}}},
+		{"instance", "dev", modules.TRACE, []*sls.Log{instance}, map[*exporterImpl][]*sls.Log{payments: {instance}}},
+		{"data type", "dev", modules.METRIC, []*sls.Log{metric}, map[*exporterImpl][]*sls.Log{dev: {metric}}},
+		{"unknown namespace", "test", modules.TRACE, []*sls.Log{order}, map[*exporterImpl][]*sls.Log{dev: {order}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed := r.route(tt.namespace, tt.dataType, tt.logs)
+			if len(routed) != len(tt.want) {
+				t.Fatalf("route() = %d destinations, want %d", len(routed), len(tt.want))
+			}
+			for _, rl := range routed {
+				want, ok := tt.want[rl.sender]
+				if !ok || len(rl.logs) != len(want) {
+					t.Fatalf("route() sent %d logs to %+v, want %d", len(rl.logs), rl.sender.destination, len(want))
+				}
+				for i := range want {
+					if rl.logs[i] != want[i] {
+						t.Errorf("route() sent log %d to %+v, want %v", i, rl.sender.destination, want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRouterWithoutRoutes(t *testing.T) {
+	dev := &exporterImpl{destination: configure.Destination{Namespace: "dev"}}
+	r := newRouter([]*exporterImpl{dev}, map[string]*exporterImpl{}, configure.Routing{})
+
+	logs := []*sls.Log{newTestLog(map[string]string{"service": "order"})}
+	routed := r.route("prod", modules.TRACE, logs)
+	if len(routed) != 1 || routed[0].sender != dev || len(routed[0].logs) != 1 {
+		t.Errorf("route() = %+v, want every log sent to the first namespace", routed)
+	}
+}
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"os"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// Within each sampleTick, the first sampleFirst entries with the same level
+	// and message are logged and after that only every sampleThereafter-th one,
+	// so that a poison topic can't flood the output.
+	sampleTick       = time.Second
+	sampleFirst      = 10
+	sampleThereafter = 100
+)
+
+// NewLogger builds the logger of the ingester. The returned level can be
+// changed at runtime, it also serves HTTP GET/PUT requests to do so.
+func NewLogger(config configure.Configuration) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(config.LogLevel())); err != nil {
+		return nil, level, err
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var encoder zapcore.Encoder
+	if config.LogFormat() == "json" {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+
+	var writer zapcore.WriteSyncer
+	if config.LogFile() == "" {
+		writer = zapcore.Lock(os.Stdout)
+	} else {
+		writer = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   config.LogFile(),
+			MaxSize:    config.LogMaxSize(),
+			MaxBackups: config.LogMaxBackups(),
+			MaxAge:     config.LogMaxAge(),
+		})
+	}
+
+	core := zapcore.NewSamplerWithOptions(zapcore.NewCore(encoder, writer, level), sampleTick, sampleFirst, sampleThereafter)
+	return zap.New(core, zap.AddCaller()), level, nil
+}
@@ -1,66 +1,139 @@
 package main
 
 import (
-	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	config "github.com/aliyun-sls/skywalking-ingester/configure"
 	"github.com/aliyun-sls/skywalking-ingester/converter"
+	"github.com/aliyun-sls/skywalking-ingester/deadletter"
 	"github.com/aliyun-sls/skywalking-ingester/exporter"
+	"github.com/aliyun-sls/skywalking-ingester/logger"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	"github.com/aliyun-sls/skywalking-ingester/pipeline"
 	"github.com/aliyun-sls/skywalking-ingester/receiver"
+	"go.uber.org/zap"
 )
 
 func main() {
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 
-	config := config.InitConfiguration()
-	receiver, exporter, converter, e := initDataOperator(config)
+	config, e := config.InitConfiguration()
+	if config.PrintConfig() {
+		fmt.Print(config.String())
+	}
 	if e != nil {
-		fmt.Println("Failed to init data operator", e)
+		fmt.Println(e)
 		os.Exit(-1)
 	}
+	if config.PrintConfig() {
+		os.Exit(0)
+	}
 
-	for {
-		select {
-		case sig := <-sigchan:
-			fmt.Printf("Caught signal %v: terminating\n", sig)
-		default:
-			orginData, e := receiver.ReceiveData()
-			if e != nil {
-				fmt.Printf("Failed to receiver data", e)
-				continue
-			}
+	log, level, e := logger.NewLogger(config)
+	if e != nil {
+		fmt.Println("Failed to init logger", e)
+		os.Exit(-1)
+	}
+	defer log.Sync()
 
-			otData, t, e := converter.Convert(orginData)
-			if e != nil {
-				fmt.Println("Failed to convert data. ", e, "data: ", hex.EncodeToString(orginData.Data()))
-			}
+	// The replay receiver has to take over the dead letters before the sink
+	// writes new ones.
+	var replay *receiver.ReplayReceiver
+	if config.ReplayDeadLetter() {
+		if replay, e = receiver.NewReplayReceiver(config, log); e != nil {
+			log.Error("Failed to init dead letter replay", zap.Error(e))
+			log.Sync()
+			os.Exit(-1)
+		}
+	}
 
-			err := exporter.Export(t, otData)
-			if err != nil {
-				fmt.Println("Failed to export data.", e)
-			}
+	receiver, exporter, converter, deadLetter, e := initDataOperator(config, log, replay)
+	if e != nil {
+		log.Error("Failed to init data operator", zap.Error(e))
+		log.Sync()
+		os.Exit(-1)
+	}
+
+	go func() {
+		if err := monitor.Serve(config.MetricsAddress(), level); err != nil {
+			log.Error("Failed to serve metrics", zap.String("address", config.MetricsAddress()), zap.Error(err))
 		}
+	}()
+
+	p := pipeline.NewPipeline(config, log, receiver, converter, exporter, deadLetter)
+	p.Start()
 
+	select {
+	case sig := <-sigchan:
+		log.Info("Caught signal, terminating", zap.Stringer("signal", sig))
+	case <-replayDone(replay):
+		log.Info("Replayed all dead letters, terminating")
 	}
+	shutdown(log, p, receiver, exporter, deadLetter, config.ShutdownTimeout())
+}
 
+func replayDone(replay *receiver.ReplayReceiver) <-chan struct{} {
+	if replay == nil {
+		return nil
+	}
+	return replay.Done()
 }
 
-func initDataOperator(config config.Configuration) (r receiver.Receiver, e exporter.Exporter, c converter.Converter, err error) {
-	r, err = receiver.NewReceiver(config)
+// shutdown drains the receiver and the pipeline and flushes the exporter before
+// the receiver commits its final offsets, and gives up once the timeout is
+// reached.
+func shutdown(log *zap.Logger, p *pipeline.Pipeline, r receiver.Receiver, e exporter.Exporter, d deadletter.Sink, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if drainer, ok := r.(receiver.Drainer); ok {
+			<-drainer.Drain()
+		}
+		p.Stop()
+		if err := e.Close(); err != nil {
+			log.Error("Failed to close exporter", zap.Error(err))
+		}
+		if d != nil {
+			if err := d.Close(); err != nil {
+				log.Error("Failed to close dead letter sink", zap.Error(err))
+			}
+		}
+		if err := r.Close(); err != nil {
+			log.Error("Failed to close receiver", zap.Error(err))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Error("Timed out draining data", zap.Duration("timeout", timeout))
+		log.Sync()
+		os.Exit(-1)
+	}
+}
+
+func initDataOperator(config config.Configuration, log *zap.Logger, replay *receiver.ReplayReceiver) (r receiver.Receiver, e exporter.Exporter, c converter.Converter, d deadletter.Sink, err error) {
+	if replay != nil {
+		r = replay
+	} else if r, err = receiver.NewReceiver(config, log); err != nil {
+		return
+	}
+
+	d, err = deadletter.NewSink(config)
 	if err != nil {
 		return
 	}
 
-	e, err = exporter.NewExporter(config)
+	e, err = exporter.NewExporter(config, log)
 	if err != nil {
 		return
 	}
 
-	c = converter.NewConverter()
-	return r, e, c, err
+	c, err = converter.NewConverter(config, log)
+	return r, e, c, d, err
 }
@@ -1,52 +1,230 @@
 package modules
 
-import "github.com/aliyun-sls/skywalking-ingester/configure"
+import (
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+)
 
 type OriginData interface {
 	Data() []byte
+	Metadata() Metadata
+}
+
+// Metadata records where an OriginData was read from, so that it can be
+// acknowledged to its receiver once it has been exported.
+type Metadata struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	// Namespace is resolved from the topic, it selects the destination of
+	// the converted data
+	Namespace string
+}
+
+// NAMESPACE_TAG is the tag of the LogGroups recording the namespace of their
+// logs.
+const NAMESPACE_TAG = "namespace"
+
+// SetNamespace tags the LogGroup with the namespace, the LogGroups of the
+// default namespace are not tagged.
+func SetNamespace(group *sls.LogGroup, namespace string) {
+	if group == nil || namespace == "" {
+		return
+	}
+	group.LogTags = append(group.LogTags, &sls.LogTag{Key: proto.String(NAMESPACE_TAG), Value: proto.String(namespace)})
+}
+
+// NamespaceOf returns the namespace the LogGroup is tagged with.
+func NamespaceOf(group *sls.LogGroup) string {
+	for _, tag := range group.GetLogTags() {
+		if tag.GetKey() == NAMESPACE_TAG {
+			return tag.GetValue()
+		}
+	}
+	return ""
 }
 
-func NewOriginData(config configure.Configuration, topic string, data []byte) OriginData {
-	switch topic {
-	case config.SegmentTopic():
-		return &SegmentOriginData{D: data}
-	case config.MetricTopic():
-		return &MetricOriginData{D: data}
-	case config.LoggingTopic():
-		return &LogggingOriginData{D: data}
+// NewOriginData wraps the data with the OriginData of the decoder of its
+// topic, data of unknown topics is wrapped with UnknownOriginData.
+func NewOriginData(config configure.Configuration, metadata Metadata, data []byte) OriginData {
+	metadata.Namespace = config.Namespace(metadata.Topic)
+	switch config.Decoder(metadata.Topic) {
+	case configure.DECODER_SEGMENT:
+		return &SegmentOriginData{D: data, M: metadata}
+	case configure.DECODER_METRIC:
+		return &MetricOriginData{D: data, M: metadata}
+	case configure.DECODER_LOGGING:
+		return &LogggingOriginData{D: data, M: metadata}
+	case configure.DECODER_METER:
+		return &MeterOriginData{D: data, M: metadata}
+	case configure.DECODER_CLR_METRIC:
+		return &CLRMetricOriginData{D: data, M: metadata}
+	case configure.DECODER_PROFILING:
+		return &ProfilingOriginData{D: data, M: metadata}
+	case configure.DECODER_BROWSER_PERF:
+		return &BrowserPerfOriginData{D: data, M: metadata}
+	case configure.DECODER_BROWSER_ERROR_LOG:
+		return &BrowserErrorLogOriginData{D: data, M: metadata}
+	case configure.DECODER_EVENT:
+		return &EventOriginData{D: data, M: metadata}
 	}
-	return nil
+	return &UnknownOriginData{D: data, M: metadata}
 }
 
 type DataType int32
 
 const (
-	TRACE   DataType = 1
-	METRIC           = 2
-	LOGGING          = 3
-	NOOP             = 4
+	TRACE      DataType = 1
+	METRIC              = 2
+	LOGGING             = 3
+	NOOP                = 4
+	DEPENDENCY          = 5
 )
 
+func (t DataType) String() string {
+	switch t {
+	case TRACE:
+		return "trace"
+	case METRIC:
+		return "metric"
+	case LOGGING:
+		return "logging"
+	case DEPENDENCY:
+		return "dependency"
+	default:
+		return "noop"
+	}
+}
+
 type SegmentOriginData struct {
 	D []byte
+	M Metadata
 }
 
 func (s *SegmentOriginData) Data() []byte {
 	return s.D
 }
 
+func (s *SegmentOriginData) Metadata() Metadata {
+	return s.M
+}
+
 type MetricOriginData struct {
 	D []byte
+	M Metadata
 }
 
 func (s *MetricOriginData) Data() []byte {
 	return s.D
 }
 
+func (s *MetricOriginData) Metadata() Metadata {
+	return s.M
+}
+
 type LogggingOriginData struct {
 	D []byte
+	M Metadata
 }
 
 func (s *LogggingOriginData) Data() []byte {
 	return s.D
 }
+
+func (s *LogggingOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type MeterOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *MeterOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *MeterOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type CLRMetricOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *CLRMetricOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *CLRMetricOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type ProfilingOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *ProfilingOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *ProfilingOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type BrowserPerfOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *BrowserPerfOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *BrowserPerfOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type BrowserErrorLogOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *BrowserErrorLogOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *BrowserErrorLogOriginData) Metadata() Metadata {
+	return s.M
+}
+
+type EventOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *EventOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *EventOriginData) Metadata() Metadata {
+	return s.M
+}
+
+// UnknownOriginData is data of a topic without decoder, it is acknowledged
+// without being exported.
+type UnknownOriginData struct {
+	D []byte
+	M Metadata
+}
+
+func (s *UnknownOriginData) Data() []byte {
+	return s.D
+}
+
+func (s *UnknownOriginData) Metadata() Metadata {
+	return s.M
+}
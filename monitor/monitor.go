@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "skywalking_ingester"
+
+var (
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Number of messages consumed from Kafka.",
+	}, []string{"topic", "partition"})
+
+	ConversionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversion_failures_total",
+		Help:      "Number of messages which failed to convert.",
+	}, []string{"type"})
+
+	RecordsProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_produced_total",
+		Help:      "Number of spans, metric samples and logs produced by conversion.",
+	}, []string{"type"})
+
+	PutLogsLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "put_logs_duration_seconds",
+		Help:      "Latency of SLS PutLogs requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"logstore"})
+
+	PutLogsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "put_logs_errors_total",
+		Help:      "Number of failed SLS PutLogs requests.",
+	}, []string{"logstore"})
+
+	BatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size_logs",
+		Help:      "Number of logs sent in one PutLogs request.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 13),
+	}, []string{"logstore"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Consumer lag of each partition reported by the Kafka statistics.",
+	}, []string{"topic", "partition"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of items waiting in a pipeline queue.",
+	}, []string{"stage", "worker"})
+
+	SampledTraces = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sampled_traces_total",
+		Help:      "Number of traces kept or dropped by tail sampling, by the policy which decided.",
+	}, []string{"decision", "policy"})
+
+	Redactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redactions_total",
+		Help:      "Number of values dropped, hashed, masked or truncated by redaction rules.",
+	}, []string{"action"})
+
+	LateRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "late_records_total",
+		Help:      "Number of records dropped by an aggregator because their window was already flushed.",
+	}, []string{"aggregator"})
+)
+
+// Serve exposes the metrics on /metrics of the address, and the log level on
+// /log/level so that it can be changed at runtime.
+func Serve(address string, logLevel http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/log/level", logLevel)
+	return http.ListenAndServe(address, mux)
+}
+
+type kafkaStatistics struct {
+	Topics map[string]struct {
+		Partitions map[string]struct {
+			ConsumerLag int64 `json:"consumer_lag"`
+		} `json:"partitions"`
+	} `json:"topics"`
+}
+
+// RecordKafkaStatistics updates the consumer lag from the JSON emitted by the
+// librdkafka statistics callback.
+func RecordKafkaStatistics(statistics string) error {
+	stats := &kafkaStatistics{}
+	if err := json.Unmarshal([]byte(statistics), stats); err != nil {
+		return err
+	}
+
+	for topic, t := range stats.Topics {
+		for partition, p := range t.Partitions {
+			// -1 is the internal UA/UnAssigned partition, lag is -1 until known.
+			if id, err := strconv.Atoi(partition); err != nil || id < 0 || p.ConsumerLag < 0 {
+				continue
+			}
+			ConsumerLag.WithLabelValues(topic, partition).Set(float64(p.ConsumerLag))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package pipeline
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/converter"
+	"github.com/aliyun-sls/skywalking-ingester/deadletter"
+	"github.com/aliyun-sls/skywalking-ingester/exporter"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	"github.com/aliyun-sls/skywalking-ingester/receiver"
+	"github.com/aliyun-sls/skywalking-ingester/sampler"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"go.uber.org/zap"
+)
+
+const flushInterval = time.Second
+
+// convertedData is the work item handed from converter workers to exporter workers.
+type convertedData struct {
+	origin   modules.OriginData
+	dataType modules.DataType
+	data     *sls.LogGroup
+}
+
+// Pipeline runs receive, convert and export on separate goroutines. Data is
+// sharded by its Kafka partition, so data of one partition is always handled
+// by the same workers in the order it was received.
+type Pipeline struct {
+	logger    *zap.Logger
+	receiver  receiver.Receiver
+	converter converter.Converter
+	exporter  exporter.Exporter
+	// deadLetter is nil if no dead letter sink is configured
+	deadLetter deadletter.Sink
+	// sampler is nil if tail sampling is disabled
+	sampler *sampler.Sampler
+
+	convertQueues []chan modules.OriginData
+	exportQueues  []chan *convertedData
+
+	stop     chan struct{}
+	polling  sync.WaitGroup
+	flushing sync.WaitGroup
+	workers  sync.WaitGroup
+	paused   bool
+	next     uint32
+}
+
+func NewPipeline(config configure.Configuration, logger *zap.Logger, r receiver.Receiver, c converter.Converter, e exporter.Exporter, deadLetter deadletter.Sink) *Pipeline {
+	p := &Pipeline{
+		logger:        logger,
+		receiver:      r,
+		converter:     c,
+		exporter:      e,
+		deadLetter:    deadLetter,
+		convertQueues: make([]chan modules.OriginData, config.ConvertWorkers()),
+		exportQueues:  make([]chan *convertedData, config.ExportWorkers()),
+		stop:          make(chan struct{}),
+	}
+
+	p.sampler = sampler.NewSampler(config, p.release)
+
+	for i := range p.convertQueues {
+		p.convertQueues[i] = make(chan modules.OriginData, config.QueueSize())
+	}
+	for i := range p.exportQueues {
+		p.exportQueues[i] = make(chan *convertedData, config.QueueSize())
+	}
+	return p
+}
+
+func (p *Pipeline) Start() {
+	convertWorkers := sync.WaitGroup{}
+	for i, queue := range p.convertQueues {
+		convertWorkers.Add(1)
+		go func(worker int, queue chan modules.OriginData) {
+			defer convertWorkers.Done()
+			p.convert(worker, queue)
+		}(i, queue)
+	}
+
+	for i, queue := range p.exportQueues {
+		p.workers.Add(1)
+		go func(worker int, queue chan *convertedData) {
+			defer p.workers.Done()
+			p.export(worker, queue)
+		}(i, queue)
+	}
+
+	// Exporter queues are closed once every converter worker has drained its queue.
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		convertWorkers.Wait()
+		for _, queue := range p.exportQueues {
+			close(queue)
+		}
+	}()
+
+	p.flushing.Add(1)
+	go func() {
+		defer p.flushing.Done()
+		p.flushPeriodically()
+	}()
+
+	p.polling.Add(1)
+	go func() {
+		defer p.polling.Done()
+		p.poll()
+	}()
+}
+
+// Stop stops polling and waits until the received data has been converted and
+// handed to the exporter, along with every window of the aggregators.
+func (p *Pipeline) Stop() {
+	close(p.stop)
+	p.polling.Wait()
+	p.flushing.Wait()
+
+	for _, queue := range p.convertQueues {
+		close(queue)
+	}
+	p.workers.Wait()
+	p.flush(time.Now(), true)
+}
+
+func (p *Pipeline) flushPeriodically() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.flush(now, false)
+		}
+	}
+}
+
+// flush releases the sampled traces and exports the closed windows of the
+// aggregators. Aggregated data has no origin to replay, so failures are only
+// logged.
+func (p *Pipeline) flush(now time.Time, final bool) {
+	if p.sampler != nil {
+		p.sampler.Decide(now, final)
+	}
+
+	for _, aggregator := range p.converter.Aggregators() {
+		groups, t := aggregator.Flush(now, final)
+		for _, data := range groups {
+			monitor.RecordsProduced.WithLabelValues(t.String()).Add(float64(len(data.Logs)))
+			err := p.exporter.Export(t, data, func(e error) {
+				if e != nil {
+					p.logger.Error("Failed to export aggregated data", zap.Stringer("type", t), zap.Error(e))
+				}
+			})
+			if err != nil {
+				p.logger.Error("Failed to export aggregated data", zap.Stringer("type", t), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (p *Pipeline) poll() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		if p.paused && p.drained() {
+			if e := p.receiver.Resume(); e != nil {
+				p.logger.Warn("Failed to resume receiver", zap.Error(e))
+			} else {
+				p.paused = false
+			}
+		}
+
+		data, e := p.receiver.ReceiveData()
+		if e != nil {
+			p.logger.Error("Failed to receive data", zap.Error(e))
+			continue
+		}
+		if data == nil {
+			continue
+		}
+
+		shard := p.shardOf(data, len(p.convertQueues))
+		queue := p.convertQueues[shard]
+		if len(queue) == cap(queue) && !p.paused {
+			// Keep the consumer alive without fetching more data while the
+			// workers catch up.
+			if e := p.receiver.Pause(); e != nil {
+				p.logger.Warn("Failed to pause receiver", zap.Error(e))
+			} else {
+				p.paused = true
+			}
+		}
+		queue <- data
+		monitor.QueueDepth.WithLabelValues("convert", strconv.Itoa(shard)).Set(float64(len(queue)))
+	}
+}
+
+// drained reports whether every queue is at most half full.
+func (p *Pipeline) drained() bool {
+	for _, queue := range p.convertQueues {
+		if len(queue) > cap(queue)/2 {
+			return false
+		}
+	}
+	for _, queue := range p.exportQueues {
+		if len(queue) > cap(queue)/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pipeline) convert(worker int, queue chan modules.OriginData) {
+	depth := monitor.QueueDepth.WithLabelValues("convert", strconv.Itoa(worker))
+	for data := range queue {
+		depth.Set(float64(len(queue)))
+
+		otData, t, e := p.converter.Convert(data)
+		if e != nil {
+			monitor.ConversionFailures.WithLabelValues(t.String()).Inc()
+			p.logger.Error("Failed to convert data", append(metadataFields(data), zap.Stringer("type", t),
+				zap.Int("size", len(data.Data())), zap.Error(e))...)
+			p.sendToDeadLetter(data, deadletter.STAGE_CONVERT, e)
+			continue
+		}
+
+		if otData != nil {
+			monitor.RecordsProduced.WithLabelValues(t.String()).Add(float64(len(otData.Logs)))
+		}
+
+		if t == modules.TRACE && p.sampler != nil {
+			p.sampler.Add(otData, data)
+			continue
+		}
+
+		shard := p.shardOf(data, len(p.exportQueues))
+		p.exportQueues[shard] <- &convertedData{origin: data, dataType: t, data: otData}
+		monitor.QueueDepth.WithLabelValues("export", strconv.Itoa(shard)).Set(float64(len(p.exportQueues[shard])))
+	}
+}
+
+func (p *Pipeline) export(worker int, queue chan *convertedData) {
+	depth := monitor.QueueDepth.WithLabelValues("export", strconv.Itoa(worker))
+	for d := range queue {
+		depth.Set(float64(len(queue)))
+
+		p.exportData(d.origin, d.dataType, d.data)
+	}
+}
+
+func (p *Pipeline) exportData(origin modules.OriginData, t modules.DataType, data *sls.LogGroup) {
+	err := p.exporter.Export(t, data, func(e error) {
+		if e != nil {
+			p.sendToDeadLetter(origin, deadletter.STAGE_EXPORT, e)
+			return
+		}
+		p.ack(origin)
+	})
+	if err != nil {
+		p.logger.Error("Failed to export data", append(metadataFields(origin), zap.Stringer("type", t), zap.Error(err))...)
+	}
+}
+
+// release exports the segments of sampled traces, segments of dropped traces
+// are acknowledged right away.
+func (p *Pipeline) release(data *sls.LogGroup, payload interface{}, keep bool) {
+	origin := payload.(modules.OriginData)
+	if !keep {
+		p.ack(origin)
+		return
+	}
+	p.exportData(origin, modules.TRACE, data)
+}
+
+func (p *Pipeline) ack(data modules.OriginData) {
+	if err := p.receiver.Ack(data); err != nil {
+		p.logger.Warn("Failed to ack data", append(metadataFields(data), zap.Error(err))...)
+	}
+}
+
+// sendToDeadLetter acknowledges data which failed at the stage once it is kept
+// in the dead letter sink, replaying it won't help until a fix ships. Without a
+// sink the data is dropped, since failures such as malformed data would block
+// the offsets of the partition forever.
+func (p *Pipeline) sendToDeadLetter(data modules.OriginData, stage string, failure error) {
+	if p.deadLetter == nil {
+		p.logger.Error("Data failed without dead letter sink, dropping it", append(metadataFields(data), zap.String("stage", stage), zap.Error(failure))...)
+		p.ack(data)
+		return
+	}
+
+	if err := p.deadLetter.Write(deadletter.NewRecord(data, stage, failure)); err != nil {
+		p.logger.Error("Failed to write dead letter", append(metadataFields(data), zap.String("stage", stage), zap.Error(err))...)
+		return
+	}
+	p.ack(data)
+}
+
+func metadataFields(data modules.OriginData) []zap.Field {
+	metadata := data.Metadata()
+	return []zap.Field{
+		zap.String("topic", metadata.Topic),
+		zap.Int32("partition", metadata.Partition),
+		zap.Int64("offset", metadata.Offset),
+	}
+}
+
+// shardOf maps the partition of the data to a worker. Data received without a
+// partition, such as from agents over gRPC, is spread round-robin.
+func (p *Pipeline) shardOf(data modules.OriginData, shards int) int {
+	metadata := data.Metadata()
+	if metadata.Topic == "" {
+		return int(atomic.AddUint32(&p.next, 1) % uint32(shards))
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(metadata.Topic))
+	h.Write([]byte{byte(metadata.Partition >> 24), byte(metadata.Partition >> 16), byte(metadata.Partition >> 8), byte(metadata.Partition)})
+	return int(h.Sum32() % uint32(shards))
+}
@@ -0,0 +1,309 @@
+package receiver
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	loggingV3 "skywalking.apache.org/repo/goapi/collect/logging/v3"
+	managementV3 "skywalking.apache.org/repo/goapi/collect/management/v3"
+)
+
+const grpcReceiverQueueSize = 1000
+
+var errReceiverStopped = status.Error(codes.Unavailable, "receiver is stopped")
+
+// GRPCReceiver serves the SkyWalking agent gRPC services, so agents can report
+// to the ingester directly instead of going through Kafka.
+type GRPCReceiver struct {
+	server *grpc.Server
+	queue  chan modules.OriginData
+	// stopTimeout is how long the calls in progress are waited for when
+	// draining, the streams still open are closed then
+	stopTimeout time.Duration
+	// lock guards the queue against being closed while data is enqueued
+	lock   sync.RWMutex
+	closed bool
+	// drained is closed once the queue is closed and empty
+	drained   chan struct{}
+	stopOnce  sync.Once
+	drainOnce sync.Once
+}
+
+func newGRPCReceiver(config configure.Configuration, logger *zap.Logger) (Receiver, error) {
+	listener, err := net.Listen("tcp", config.GRPCAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &GRPCReceiver{
+		server: grpc.NewServer(),
+		queue:  make(chan modules.OriginData, grpcReceiverQueueSize),
+		// the rest of the shutdown timeout is left to export the queued data
+		stopTimeout: config.ShutdownTimeout() / 2,
+		drained:     make(chan struct{}),
+	}
+
+	agentV3.RegisterTraceSegmentReportServiceServer(r.server, &traceSegmentReportService{receiver: r})
+	agentV3.RegisterJVMMetricReportServiceServer(r.server, &jvmMetricReportService{receiver: r})
+	agentV3.RegisterMeterReportServiceServer(r.server, &meterReportService{receiver: r})
+	agentV3.RegisterCLRMetricReportServiceServer(r.server, &clrMetricReportService{receiver: r})
+	loggingV3.RegisterLogReportServiceServer(r.server, &logReportService{receiver: r})
+	managementV3.RegisterManagementServiceServer(r.server, &managementService{})
+
+	go func() {
+		if e := r.server.Serve(listener); e != nil {
+			logger.Error("gRPC receiver stopped serving", zap.String("address", config.GRPCAddress()), zap.Error(e))
+		}
+	}()
+
+	return r, nil
+}
+
+func (r *GRPCReceiver) ReceiveData() (modules.OriginData, error) {
+	timeout := time.After(time.Second)
+	select {
+	case data, ok := <-r.queue:
+		if ok {
+			return data, nil
+		}
+		r.drainOnce.Do(func() { close(r.drained) })
+		<-timeout
+		return nil, nil
+	case <-timeout:
+		return nil, nil
+	}
+}
+
+// Drain stops accepting data once the calls in progress are answered, or once
+// the stop timeout is reached, since agents keep their streams open. The
+// returned channel is closed once the queued data has been received, so that
+// the data agents were told is accepted is exported before the pipeline stops.
+func (r *GRPCReceiver) Drain() <-chan struct{} {
+	r.stopOnce.Do(func() {
+		stopped := make(chan struct{})
+		go func() {
+			r.server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(r.stopTimeout):
+			// cancels the calls still blocked on the queue as well
+			r.server.Stop()
+			<-stopped
+		}
+
+		r.lock.Lock()
+		r.closed = true
+		close(r.queue)
+		r.lock.Unlock()
+	})
+	return r.drained
+}
+
+// Ack is a no-op, agents are answered as soon as their data is queued.
+func (r *GRPCReceiver) Ack(data modules.OriginData) error {
+	return nil
+}
+
+// Pause is a no-op, agents are blocked by the bounded queue instead.
+func (r *GRPCReceiver) Pause() error {
+	return nil
+}
+
+func (r *GRPCReceiver) Resume() error {
+	return nil
+}
+
+// Close stops serving agents, Drain should be called first so that the queued
+// data is exported.
+func (r *GRPCReceiver) Close() error {
+	r.server.Stop()
+	return nil
+}
+
+func (r *GRPCReceiver) enqueue(ctx context.Context, message proto.Message, newOriginData func([]byte) modules.OriginData) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.closed {
+		return errReceiverStopped
+	}
+
+	select {
+	case r.queue <- newOriginData(data):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newSegmentOriginData(data []byte) modules.OriginData {
+	return &modules.SegmentOriginData{D: data}
+}
+
+func newMetricOriginData(data []byte) modules.OriginData {
+	return &modules.MetricOriginData{D: data}
+}
+
+func newCLRMetricOriginData(data []byte) modules.OriginData {
+	return &modules.CLRMetricOriginData{D: data}
+}
+
+func newMeterOriginData(data []byte) modules.OriginData {
+	return &modules.MeterOriginData{D: data}
+}
+
+func newLoggingOriginData(data []byte) modules.OriginData {
+	return &modules.LogggingOriginData{D: data}
+}
+
+type traceSegmentReportService struct {
+	agentV3.UnimplementedTraceSegmentReportServiceServer
+	receiver *GRPCReceiver
+}
+
+func (s *traceSegmentReportService) Collect(stream agentV3.TraceSegmentReportService_CollectServer) error {
+	for {
+		segment, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&v3.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.receiver.enqueue(stream.Context(), segment, newSegmentOriginData); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *traceSegmentReportService) CollectInSync(ctx context.Context, segments *agentV3.SegmentCollection) (*v3.Commands, error) {
+	for _, segment := range segments.GetSegments() {
+		if err := s.receiver.enqueue(ctx, segment, newSegmentOriginData); err != nil {
+			return nil, err
+		}
+	}
+	return &v3.Commands{}, nil
+}
+
+type jvmMetricReportService struct {
+	agentV3.UnimplementedJVMMetricReportServiceServer
+	receiver *GRPCReceiver
+}
+
+func (s *jvmMetricReportService) Collect(ctx context.Context, metrics *agentV3.JVMMetricCollection) (*v3.Commands, error) {
+	if err := s.receiver.enqueue(ctx, metrics, newMetricOriginData); err != nil {
+		return nil, err
+	}
+	return &v3.Commands{}, nil
+}
+
+type clrMetricReportService struct {
+	agentV3.UnimplementedCLRMetricReportServiceServer
+	receiver *GRPCReceiver
+}
+
+func (s *clrMetricReportService) Collect(ctx context.Context, metrics *agentV3.CLRMetricCollection) (*v3.Commands, error) {
+	if err := s.receiver.enqueue(ctx, metrics, newCLRMetricOriginData); err != nil {
+		return nil, err
+	}
+	return &v3.Commands{}, nil
+}
+
+type meterReportService struct {
+	agentV3.UnimplementedMeterReportServiceServer
+	receiver *GRPCReceiver
+}
+
+// Collect queues the meters of a stream as one collection, agents only set the
+// service and instance on the first meter of the stream.
+func (s *meterReportService) Collect(stream agentV3.MeterReportService_CollectServer) error {
+	meters := &agentV3.MeterDataCollection{}
+	for {
+		meter, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		meters.MeterData = append(meters.MeterData, meter)
+	}
+
+	if len(meters.MeterData) > 0 {
+		if err := s.receiver.enqueue(stream.Context(), meters, newMeterOriginData); err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(&v3.Commands{})
+}
+
+func (s *meterReportService) CollectBatch(stream agentV3.MeterReportService_CollectBatchServer) error {
+	for {
+		meters, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&v3.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.receiver.enqueue(stream.Context(), meters, newMeterOriginData); err != nil {
+			return err
+		}
+	}
+}
+
+type logReportService struct {
+	loggingV3.UnimplementedLogReportServiceServer
+	receiver *GRPCReceiver
+}
+
+func (s *logReportService) Collect(stream loggingV3.LogReportService_CollectServer) error {
+	for {
+		log, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&v3.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.receiver.enqueue(stream.Context(), log, newLoggingOriginData); err != nil {
+			return err
+		}
+	}
+}
+
+// managementService accepts instance registrations and keep-alives so that agents
+// consider the backend healthy. Nothing is exported for them.
+type managementService struct {
+	managementV3.UnimplementedManagementServiceServer
+}
+
+func (s *managementService) ReportInstanceProperties(ctx context.Context, properties *managementV3.InstanceProperties) (*v3.Commands, error) {
+	return &v3.Commands{}, nil
+}
+
+func (s *managementService) KeepAlive(ctx context.Context, ping *managementV3.InstancePingPkg) (*v3.Commands, error) {
+	return &v3.Commands{}, nil
+}
@@ -0,0 +1,93 @@
+package receiver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"google.golang.org/grpc"
+	agentV3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+func TestGRPCReceiverDrain(t *testing.T) {
+	r := &GRPCReceiver{
+		server:  grpc.NewServer(),
+		queue:   make(chan modules.OriginData, grpcReceiverQueueSize),
+		drained: make(chan struct{}),
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := r.enqueue(context.Background(), &agentV3.SegmentObject{TraceId: id}, newSegmentOriginData); err != nil {
+			t.Fatalf("enqueue() error = %v", err)
+		}
+	}
+
+	drained := r.Drain()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-drained:
+			t.Fatalf("drained before the queued data %d was received", i)
+		default:
+		}
+		if data, err := r.ReceiveData(); err != nil || data == nil {
+			t.Fatalf("ReceiveData() = %v, %v, want the queued data", data, err)
+		}
+	}
+
+	if data, err := r.ReceiveData(); err != nil || data != nil {
+		t.Fatalf("ReceiveData() after the queue is empty = %v, %v, want nil", data, err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained once the queue is empty")
+	}
+
+	if again := r.Drain(); again != drained {
+		t.Error("Drain() called again returned another channel")
+	}
+	if err := r.enqueue(context.Background(), &agentV3.SegmentObject{TraceId: "c"}, newSegmentOriginData); err != errReceiverStopped {
+		t.Errorf("enqueue() after Drain() error = %v, want %v", err, errReceiverStopped)
+	}
+}
+
+func TestGRPCReceiverDrainOpenStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	r := &GRPCReceiver{
+		server:      grpc.NewServer(),
+		queue:       make(chan modules.OriginData, grpcReceiverQueueSize),
+		stopTimeout: 50 * time.Millisecond,
+		drained:     make(chan struct{}),
+	}
+	agentV3.RegisterTraceSegmentReportServiceServer(r.server, &traceSegmentReportService{receiver: r})
+	go r.server.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	// the stream is left open like the ones of agents
+	stream, err := agentV3.NewTraceSegmentReportServiceClient(conn).Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if err := stream.Send(&agentV3.SegmentObject{TraceId: "a"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if data, err := r.ReceiveData(); err != nil || data == nil {
+		t.Fatalf("ReceiveData() = %v, %v, want the sent data", data, err)
+	}
+
+	stopped := make(chan (<-chan struct{}))
+	go func() { stopped <- r.Drain() }()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Drain() blocked by an open stream")
+	}
+}
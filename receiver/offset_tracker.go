@@ -0,0 +1,118 @@
+package receiver
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionWatermark tracks the offsets of one partition that have been
+// received but not yet acknowledged. The watermark only moves past an offset
+// once every offset received before it has been acknowledged as well.
+type partitionWatermark struct {
+	pending   []int64
+	acked     map[int64]bool
+	watermark kafka.Offset
+	committed kafka.Offset
+}
+
+func newPartitionWatermark() *partitionWatermark {
+	return &partitionWatermark{
+		acked:     make(map[int64]bool),
+		watermark: kafka.OffsetInvalid,
+		committed: kafka.OffsetInvalid,
+	}
+}
+
+func (w *partitionWatermark) ack(offset int64) {
+	// The offsets are received in order. Acks of offsets which are not pending,
+	// such as the data received before the partition was revoked, are ignored
+	// so that they are not kept forever.
+	i := sort.Search(len(w.pending), func(i int) bool { return w.pending[i] >= offset })
+	if i == len(w.pending) || w.pending[i] != offset {
+		return
+	}
+
+	w.acked[offset] = true
+	for len(w.pending) > 0 && w.acked[w.pending[0]] {
+		delete(w.acked, w.pending[0])
+		w.watermark = kafka.Offset(w.pending[0] + 1)
+		w.pending = w.pending[1:]
+	}
+}
+
+type offsetTracker struct {
+	lock       sync.Mutex
+	partitions map[partitionKey]*partitionWatermark
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionWatermark)}
+}
+
+func (t *offsetTracker) track(topic string, partition int32, offset int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := partitionKey{topic: topic, partition: partition}
+	w, ok := t.partitions[key]
+	if !ok {
+		w = newPartitionWatermark()
+		t.partitions[key] = w
+	}
+	w.pending = append(w.pending, offset)
+}
+
+func (t *offsetTracker) ack(topic string, partition int32, offset int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// The partition may have been revoked while the data was in flight, in
+	// which case its new owner will consume it again.
+	if w, ok := t.partitions[partitionKey{topic: topic, partition: partition}]; ok {
+		w.ack(offset)
+	}
+}
+
+// committable returns the watermark of every partition that advanced since
+// the last commit.
+func (t *offsetTracker) committable() []kafka.TopicPartition {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	offsets := make([]kafka.TopicPartition, 0)
+	for key, w := range t.partitions {
+		if w.watermark == kafka.OffsetInvalid || w.watermark == w.committed {
+			continue
+		}
+		topic := key.topic
+		offsets = append(offsets, kafka.TopicPartition{Topic: &topic, Partition: key.partition, Offset: w.watermark})
+	}
+	return offsets
+}
+
+func (t *offsetTracker) committed(offsets []kafka.TopicPartition) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, o := range offsets {
+		if w, ok := t.partitions[partitionKey{topic: *o.Topic, partition: o.Partition}]; ok {
+			w.committed = o.Offset
+		}
+	}
+}
+
+func (t *offsetTracker) revoke(partitions []kafka.TopicPartition) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, p := range partitions {
+		delete(t.partitions, partitionKey{topic: *p.Topic, partition: p.Partition})
+	}
+}
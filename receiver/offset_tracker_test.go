@@ -0,0 +1,176 @@
+package receiver
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// trackerOp is a call on the tracker, topics "a" and "b" are used.
+type trackerOp struct {
+	op        string
+	topic     string
+	partition int32
+	offset    int64
+}
+
+func track(topic string, partition int32, offset int64) trackerOp {
+	return trackerOp{op: "track", topic: topic, partition: partition, offset: offset}
+}
+
+func ack(topic string, partition int32, offset int64) trackerOp {
+	return trackerOp{op: "ack", topic: topic, partition: partition, offset: offset}
+}
+
+func revoke(topic string, partition int32) trackerOp {
+	return trackerOp{op: "revoke", topic: topic, partition: partition}
+}
+
+// commit commits the committable offsets.
+func commit() trackerOp {
+	return trackerOp{op: "commit"}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []trackerOp
+		// want maps the committable partitions to their offsets
+		want map[string]kafka.Offset
+		// acked is the number of acks kept per partition
+		acked map[string]int
+	}{
+		{
+			name: "nothing acked",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 11)},
+			want: map[string]kafka.Offset{},
+		},
+		{
+			name: "in order",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 11), ack("a", 0, 10), ack("a", 0, 11)},
+			want: map[string]kafka.Offset{"a/0": 12},
+		},
+		{
+			name:  "out of order",
+			ops:   []trackerOp{track("a", 0, 10), track("a", 0, 11), track("a", 0, 12), ack("a", 0, 12), ack("a", 0, 10)},
+			want:  map[string]kafka.Offset{"a/0": 11},
+			acked: map[string]int{"a/0": 1},
+		},
+		{
+			name: "out of order completed",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 11), track("a", 0, 12), ack("a", 0, 12), ack("a", 0, 11), ack("a", 0, 10)},
+			want: map[string]kafka.Offset{"a/0": 13},
+		},
+		{
+			name: "gap in offsets",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 15), track("a", 0, 20), ack("a", 0, 15), ack("a", 0, 10)},
+			want: map[string]kafka.Offset{"a/0": 16},
+		},
+		{
+			name: "partitions are independent",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 1, 5), track("b", 0, 7), ack("a", 1, 5), ack("b", 0, 7)},
+			want: map[string]kafka.Offset{"a/1": 6, "b/0": 8},
+		},
+		{
+			name: "committed offsets are not returned again",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 11), ack("a", 0, 10), commit(), track("b", 0, 1), ack("b", 0, 1)},
+			want: map[string]kafka.Offset{"b/0": 2},
+		},
+		{
+			name: "advanced after commit",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 11), ack("a", 0, 10), commit(), ack("a", 0, 11)},
+			want: map[string]kafka.Offset{"a/0": 12},
+		},
+		{
+			name: "ack after revoke",
+			ops:  []trackerOp{track("a", 0, 10), revoke("a", 0), ack("a", 0, 10)},
+			want: map[string]kafka.Offset{},
+		},
+		{
+			name: "revoke then re-assign",
+			ops: []trackerOp{track("a", 0, 10), track("a", 0, 11), ack("a", 0, 10), revoke("a", 0),
+				track("a", 0, 11), track("a", 0, 12), ack("a", 0, 10), ack("a", 0, 12)},
+			want:  map[string]kafka.Offset{},
+			acked: map[string]int{"a/0": 1},
+		},
+		{
+			name: "re-assigned partition advances",
+			ops: []trackerOp{track("a", 0, 10), revoke("a", 0),
+				track("a", 0, 10), track("a", 0, 11), ack("a", 0, 10), ack("a", 0, 11)},
+			want: map[string]kafka.Offset{"a/0": 12},
+		},
+		{
+			name: "unknown offsets are ignored",
+			ops:  []trackerOp{track("a", 0, 10), track("a", 0, 12), ack("a", 0, 9), ack("a", 0, 11), ack("a", 0, 13)},
+			want: map[string]kafka.Offset{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, op := range tt.ops {
+				topic := op.topic
+				switch op.op {
+				case "track":
+					tracker.track(op.topic, op.partition, op.offset)
+				case "ack":
+					tracker.ack(op.topic, op.partition, op.offset)
+				case "revoke":
+					tracker.revoke([]kafka.TopicPartition{{Topic: &topic, Partition: op.partition}})
+				case "commit":
+					tracker.committed(tracker.committable())
+				}
+			}
+
+			got := make(map[string]kafka.Offset)
+			for _, p := range tracker.committable() {
+				got[partitionName(*p.Topic, p.Partition)] = p.Offset
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("committable() = %v, want %v", got, tt.want)
+			}
+
+			acked := make(map[string]int)
+			for key, w := range tracker.partitions {
+				if len(w.acked) > 0 {
+					acked[partitionName(key.topic, key.partition)] = len(w.acked)
+				}
+			}
+			if tt.acked == nil {
+				tt.acked = map[string]int{}
+			}
+			if !reflect.DeepEqual(acked, tt.acked) {
+				t.Errorf("acked = %v, want %v", acked, tt.acked)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerCommittableOrder(t *testing.T) {
+	tracker := newOffsetTracker()
+	for partition := int32(0); partition < 4; partition++ {
+		tracker.track("a", partition, 1)
+		tracker.ack("a", partition, 1)
+	}
+
+	offsets := tracker.committable()
+	partitions := make([]int, 0, len(offsets))
+	for _, o := range offsets {
+		if o.Offset != 2 {
+			t.Errorf("committable() offset of partition %d = %v, want 2", o.Partition, o.Offset)
+		}
+		partitions = append(partitions, int(o.Partition))
+	}
+	sort.Ints(partitions)
+	if !reflect.DeepEqual(partitions, []int{0, 1, 2, 3}) {
+		t.Errorf("committable() partitions = %v, want 0-3", partitions)
+	}
+}
+
+func partitionName(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
@@ -1,40 +1,91 @@
 package receiver
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/aliyun-sls/skywalking-ingester/configure"
 	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.uber.org/zap"
 )
 
+const commitInterval = time.Second
+
 type Receiver interface {
 	ReceiveData() (modules.OriginData, error)
+	// Ack marks the data as exported. Data which is never acknowledged will be
+	// received again after a restart or rebalance.
+	Ack(modules.OriginData) error
+	// Pause stops receiving new data until Resume is called.
+	Pause() error
+	Resume() error
+	// Close commits the offsets acknowledged so far and releases the receiver.
+	Close() error
+}
+
+// Drainer is implemented by the receivers which answer the senders as soon as
+// their data is received. Drain stops receiving new data, the returned channel
+// is closed once every data already accepted has been returned by ReceiveData.
+type Drainer interface {
+	Drain() <-chan struct{}
+}
+
+func NewReceiver(config configure.Configuration, logger *zap.Logger) (Receiver, error) {
+	switch config.ReceiverType() {
+	case configure.GRPC_RECEIVER:
+		return newGRPCReceiver(config, logger)
+	default:
+		return newKafkaReceiver(config, logger)
+	}
 }
 
-func NewReceiver(config configure.Configuration) (Receiver, error) {
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers":  config.BootstrapServers(),
-		"group.id":           config.GroupID(),
-		"session.timeout.ms": 6000,
-		"auto.offset.reset":  "latest",
-	})
+func newKafkaReceiver(config configure.Configuration, logger *zap.Logger) (Receiver, error) {
+	cm := kafka.ConfigMap{
+		"bootstrap.servers":      config.BootstrapServers(),
+		"group.id":               config.GroupID(),
+		"session.timeout.ms":     6000,
+		"auto.offset.reset":      config.KafkaAutoOffsetReset(),
+		"enable.auto.commit":     false,
+		"statistics.interval.ms": 15000,
+	}
+	for k, v := range config.KafkaProperties() {
+		if err := cm.SetKey(k, v); err != nil {
+			return nil, err
+		}
+	}
 
+	c, err := kafka.NewConsumer(&cm)
 	if err != nil {
 		return nil, err
 	}
 
-	if e := c.SubscribeTopics(config.Topics(), nil); e != nil {
-		return nil, err
+	r := &KafkaReceiver{consumer: c, config: config, logger: logger.With(zap.String("receiver", "kafka")), tracker: newOffsetTracker(), lastCommit: time.Now()}
+	if e := c.SubscribeTopics(config.Topics(), r.rebalance); e != nil {
+		return nil, e
 	}
 
-	return &KafkaReceiver{consumer: c, config: config}, nil
+	return r, nil
 }
 
 type KafkaReceiver struct {
-	consumer *kafka.Consumer
-	config   configure.Configuration
+	consumer   *kafka.Consumer
+	config     configure.Configuration
+	logger     *zap.Logger
+	tracker    *offsetTracker
+	lastCommit time.Time
+	paused     bool
 }
 
 func (r *KafkaReceiver) ReceiveData() (modules.OriginData, error) {
+	if time.Since(r.lastCommit) >= commitInterval {
+		if e := r.commit(); e != nil {
+			r.logger.Warn("Failed to commit offsets", zap.Error(e))
+		}
+	}
+
 	ev := r.consumer.Poll(1000)
 	if ev == nil {
 		return nil, nil
@@ -42,11 +93,100 @@ func (r *KafkaReceiver) ReceiveData() (modules.OriginData, error) {
 
 	switch e := ev.(type) {
 	case *kafka.Message:
-		return modules.NewOriginData(r.config, *e.TopicPartition.Topic, e.Value), nil
-	case *kafka.Error:
+		monitor.MessagesConsumed.WithLabelValues(*e.TopicPartition.Topic, strconv.Itoa(int(e.TopicPartition.Partition))).Inc()
+		data := modules.NewOriginData(r.config, modules.Metadata{
+			Topic:     *e.TopicPartition.Topic,
+			Partition: e.TopicPartition.Partition,
+			Offset:    int64(e.TopicPartition.Offset),
+		}, e.Value)
+		if _, ok := data.(*modules.UnknownOriginData); ok {
+			r.logger.Warn("Skip message of unknown topic", zap.String("topic", *e.TopicPartition.Topic),
+				zap.Int32("partition", e.TopicPartition.Partition), zap.Int64("offset", int64(e.TopicPartition.Offset)))
+		}
+		r.tracker.track(*e.TopicPartition.Topic, e.TopicPartition.Partition, int64(e.TopicPartition.Offset))
+		return data, nil
+	case kafka.Error:
 		return nil, e
+	case *kafka.Stats:
+		if err := monitor.RecordKafkaStatistics(e.String()); err != nil {
+			r.logger.Warn("Failed to parse kafka statistics", zap.Error(err))
+		}
+		return nil, nil
 	default:
 		return nil, nil
 	}
 
 }
+
+func (r *KafkaReceiver) Ack(data modules.OriginData) error {
+	metadata := data.Metadata()
+	r.tracker.ack(metadata.Topic, metadata.Partition, metadata.Offset)
+	return nil
+}
+
+func (r *KafkaReceiver) Pause() error {
+	partitions, err := r.consumer.Assignment()
+	if err != nil {
+		return err
+	}
+
+	r.paused = true
+	return r.consumer.Pause(partitions)
+}
+
+func (r *KafkaReceiver) Resume() error {
+	partitions, err := r.consumer.Assignment()
+	if err != nil {
+		return err
+	}
+
+	r.paused = false
+	return r.consumer.Resume(partitions)
+}
+
+func (r *KafkaReceiver) Close() error {
+	if e := r.commit(); e != nil {
+		r.logger.Warn("Failed to commit final offsets", zap.Error(e))
+	}
+	return r.consumer.Close()
+}
+
+func (r *KafkaReceiver) commit() error {
+	r.lastCommit = time.Now()
+
+	offsets := r.tracker.committable()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	if _, e := r.consumer.CommitOffsets(offsets); e != nil {
+		return e
+	}
+	r.tracker.committed(offsets)
+	return nil
+}
+
+func (r *KafkaReceiver) rebalance(c *kafka.Consumer, ev kafka.Event) error {
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		r.logger.Info("Partitions assigned", zap.String("partitions", fmt.Sprint(e.Partitions)))
+		if err := c.Assign(e.Partitions); err != nil {
+			return err
+		}
+		// Newly assigned partitions have to wait for the backlog as well.
+		if r.paused {
+			return c.Pause(e.Partitions)
+		}
+		return nil
+	case kafka.RevokedPartitions:
+		// Commit whatever has been exported before the partitions are handed over,
+		// anything still in flight will be consumed again by the new owner.
+		if err := r.commit(); err != nil {
+			r.logger.Warn("Failed to commit offsets before rebalance", zap.Error(err))
+		}
+		r.logger.Info("Partitions revoked", zap.String("partitions", fmt.Sprint(e.Partitions)))
+		r.tracker.revoke(e.Partitions)
+		return c.Unassign()
+	}
+	return nil
+}
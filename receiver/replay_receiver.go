@@ -0,0 +1,105 @@
+package receiver
+
+import (
+	"io"
+	"sync"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/deadletter"
+	"github.com/aliyun-sls/skywalking-ingester/modules"
+	"go.uber.org/zap"
+)
+
+// ReplayReceiver re-injects dead-lettered records into the pipeline as if they
+// were received from their original topic.
+type ReplayReceiver struct {
+	reader deadletter.Reader
+	config configure.Configuration
+	logger *zap.Logger
+	done   chan struct{}
+	// tracker keeps the positions of the records in the sink, only the
+	// records acknowledged by the pipeline are marked as replayed
+	tracker   *offsetTracker
+	lock      sync.Mutex
+	positions map[modules.OriginData]deadletter.Position
+}
+
+func NewReplayReceiver(config configure.Configuration, logger *zap.Logger) (*ReplayReceiver, error) {
+	reader, err := deadletter.NewReader(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayReceiver{
+		reader:    reader,
+		config:    config,
+		logger:    logger.With(zap.String("receiver", "replay")),
+		done:      make(chan struct{}),
+		tracker:   newOffsetTracker(),
+		positions: make(map[modules.OriginData]deadletter.Position),
+	}, nil
+}
+
+// Done is closed once every dead letter has been received.
+func (r *ReplayReceiver) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *ReplayReceiver) ReceiveData() (modules.OriginData, error) {
+	select {
+	case <-r.done:
+		return nil, nil
+	default:
+	}
+
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		close(r.done)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := modules.NewOriginData(r.config, record.Metadata(), record.Data)
+	if _, ok := data.(*modules.UnknownOriginData); ok {
+		r.logger.Warn("Skip dead letter of unknown topic", zap.String("topic", record.Topic),
+			zap.Int32("partition", record.Partition), zap.Int64("offset", record.Offset))
+	}
+
+	r.lock.Lock()
+	r.positions[data] = record.Position
+	r.lock.Unlock()
+	r.tracker.track("", record.Position.Partition, record.Position.Offset)
+	return data, nil
+}
+
+// Ack records that the data has been exported, or dead-lettered again. The
+// records are marked as replayed when the receiver is closed.
+func (r *ReplayReceiver) Ack(data modules.OriginData) error {
+	r.lock.Lock()
+	position, ok := r.positions[data]
+	delete(r.positions, data)
+	r.lock.Unlock()
+
+	if ok {
+		r.tracker.ack("", position.Partition, position.Offset)
+	}
+	return nil
+}
+
+func (r *ReplayReceiver) Pause() error {
+	return nil
+}
+
+func (r *ReplayReceiver) Resume() error {
+	return nil
+}
+
+func (r *ReplayReceiver) Close() error {
+	replayed := make(map[int32]int64)
+	for _, o := range r.tracker.committable() {
+		replayed[o.Partition] = int64(o.Offset)
+	}
+	return r.reader.Close(replayed)
+}
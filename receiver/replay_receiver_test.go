@@ -0,0 +1,80 @@
+package receiver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/deadletter"
+	"go.uber.org/zap"
+)
+
+type replayConfiguration struct {
+	configure.Configuration
+	dir string
+}
+
+func (c *replayConfiguration) DeadLetterType() string        { return configure.FILE_DEAD_LETTER }
+func (c *replayConfiguration) DeadLetterDirectory() string   { return c.dir }
+func (c *replayConfiguration) Decoder(topic string) string   { return configure.DECODER_SEGMENT }
+func (c *replayConfiguration) Namespace(topic string) string { return "" }
+
+// replay reads every dead letter and acks the ones of the offsets given.
+func replay(t *testing.T, config configure.Configuration, acked map[int64]bool) int {
+	r, err := NewReplayReceiver(config, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReplayReceiver() error = %v", err)
+	}
+
+	read := 0
+	for {
+		data, err := r.ReceiveData()
+		if err != nil {
+			t.Fatalf("ReceiveData() error = %v", err)
+		}
+		if data == nil {
+			break
+		}
+		read++
+		if acked[data.Metadata().Offset] {
+			r.Ack(data)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return read
+}
+
+func TestReplayReceiverMarksAckedRecords(t *testing.T) {
+	dir := t.TempDir()
+	lines := make([]string, 0)
+	for offset := int64(1); offset <= 3; offset++ {
+		line, _ := json.Marshal(&deadletter.Record{Topic: configure.SEGMENTS_TOPIC, Offset: offset, Data: []byte{}})
+		lines = append(lines, string(line))
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "dead-letter.log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	config := &replayConfiguration{dir: dir}
+
+	// the second record failed to be written back
+	if read := replay(t, config, map[int64]bool{1: true, 3: true}); read != 3 {
+		t.Fatalf("replayed %d records, want 3", read)
+	}
+	if read := replay(t, config, map[int64]bool{1: true, 2: true, 3: true}); read != 3 {
+		t.Fatalf("replayed %d records again, want 3", read)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 0 {
+		t.Errorf("files left after every record was replayed: %v", files)
+	}
+	if read := replay(t, config, nil); read != 0 {
+		t.Errorf("replayed %d records after every record was replayed, want 0", read)
+	}
+}
+
@@ -0,0 +1,337 @@
+package sampler
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/converter"
+	"github.com/aliyun-sls/skywalking-ingester/monitor"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+)
+
+const (
+	// POLICY_ERROR the trace has a failed span
+	POLICY_ERROR = "error"
+	// POLICY_LATENCY the trace has a span slower than the latency threshold
+	POLICY_LATENCY = "latency"
+	// POLICY_PROBABILITY the trace was sampled by the probability of its service
+	POLICY_PROBABILITY = "probability"
+	// POLICY_RATE_LIMIT the endpoint of the trace exceeded its rate limit
+	POLICY_RATE_LIMIT = "rate_limit"
+	// POLICY_FALLBACK the buffer was full when the trace arrived
+	POLICY_FALLBACK = "fallback"
+	// POLICY_LATE the trace arrived after its decision was made
+	POLICY_LATE = "late"
+)
+
+// Release receives a segment once the decision of its trace is made. The
+// payload is the value passed to Add along with the segment.
+type Release func(data *sls.LogGroup, payload interface{}, keep bool)
+
+type segment struct {
+	data    *sls.LogGroup
+	payload interface{}
+}
+
+// trace is the segments of a trace buffered until its decision is made.
+type trace struct {
+	id       string
+	arrived  time.Time
+	segments []*segment
+	spans    int
+	// service and endpoint of the root span, or of the first span until the
+	// root segment arrives
+	service  string
+	endpoint string
+	rooted   bool
+	isError  bool
+	duration int64
+	// evicted is set once the trace is decided by the fallback
+	evicted bool
+}
+
+type decision struct {
+	traceID string
+	keep    bool
+	expires time.Time
+}
+
+// Sampler buffers the segments of a trace for the decision wait, and keeps the
+// whole trace or drops it according to the policies. SkyWalking reports one
+// segment per process, so policies only see segments received by this
+// ingester within the wait.
+type Sampler struct {
+	release Release
+
+	decisionWait         time.Duration
+	latencyThreshold     int64
+	probability          float64
+	serviceProbabilities map[string]float64
+	rateLimit            float64
+	maxSpans             int
+	fallback             bool
+
+	lock      sync.Mutex
+	traces    map[string]*trace
+	order     []*trace
+	spans     int
+	decided   map[string]bool
+	decisions []decision
+	limiters  map[string]*rateLimiter
+}
+
+// NewSampler returns nil if sampling is disabled.
+func NewSampler(config configure.Configuration, release Release) *Sampler {
+	if !config.Sampling() {
+		return nil
+	}
+
+	return &Sampler{
+		release:              release,
+		decisionWait:         config.SamplingDecisionWait(),
+		latencyThreshold:     config.SamplingLatencyThreshold().Microseconds(),
+		probability:          config.SamplingProbability(),
+		serviceProbabilities: config.SamplingServiceProbabilities(),
+		rateLimit:            config.SamplingEndpointRateLimit(),
+		maxSpans:             config.SamplingMaxSpans(),
+		fallback:             config.SamplingFallback() == configure.SAMPLING_FALLBACK_KEEP,
+		traces:               make(map[string]*trace),
+		decided:              make(map[string]bool),
+		limiters:             make(map[string]*rateLimiter),
+	}
+}
+
+// Add buffers the spans of a segment converted to a log group. Segments of
+// decided traces, and segments which don't fit into the buffer, are released
+// right away.
+func (s *Sampler) Add(data *sls.LogGroup, payload interface{}) {
+	if data == nil || len(data.Logs) == 0 {
+		s.release(data, payload, true)
+		return
+	}
+
+	spans := parseSpans(data)
+	traceID := spans[0].traceID
+
+	s.lock.Lock()
+	if keep, ok := s.decided[traceID]; ok {
+		s.lock.Unlock()
+		monitor.SampledTraces.WithLabelValues(decisionLabel(keep), POLICY_LATE).Inc()
+		s.release(data, payload, keep)
+		return
+	}
+
+	t, ok := s.traces[traceID]
+	if s.spans+len(spans) > s.maxSpans {
+		// The buffered segments of the trace are decided along with the
+		// segment, so that the trace is kept or dropped as a whole.
+		segments := []*segment{{data: data, payload: payload}}
+		if ok {
+			segments = append(t.segments, segments...)
+			t.evicted = true
+			delete(s.traces, traceID)
+			s.spans -= t.spans
+		}
+		s.remember(traceID, s.fallback, time.Now())
+		s.lock.Unlock()
+
+		monitor.SampledTraces.WithLabelValues(decisionLabel(s.fallback), POLICY_FALLBACK).Inc()
+		for _, segment := range segments {
+			s.release(segment.data, segment.payload, s.fallback)
+		}
+		return
+	}
+	if !ok {
+		t = &trace{id: traceID, arrived: time.Now()}
+		s.traces[traceID] = t
+		s.order = append(s.order, t)
+	}
+
+	t.segments = append(t.segments, &segment{data: data, payload: payload})
+	t.spans += len(spans)
+	s.spans += len(spans)
+	for _, span := range spans {
+		t.add(span)
+	}
+	s.lock.Unlock()
+}
+
+// Decide releases the traces which have waited for the decision wait at now,
+// or every trace if final is set.
+func (s *Sampler) Decide(now time.Time, final bool) {
+	s.lock.Lock()
+	decided := make(map[*trace]bool)
+	for len(s.order) > 0 {
+		t := s.order[0]
+		if !final && now.Sub(t.arrived) < s.decisionWait {
+			break
+		}
+		s.order = s.order[1:]
+		if t.evicted {
+			continue
+		}
+
+		keep, policy := s.decide(t, now)
+		monitor.SampledTraces.WithLabelValues(decisionLabel(keep), policy).Inc()
+		decided[t] = keep
+
+		delete(s.traces, t.id)
+		s.spans -= t.spans
+		s.remember(t.id, keep, now)
+	}
+	s.expire(now)
+	s.lock.Unlock()
+
+	for t, keep := range decided {
+		for _, segment := range t.segments {
+			s.release(segment.data, segment.payload, keep)
+		}
+	}
+}
+
+func (s *Sampler) decide(t *trace, now time.Time) (bool, string) {
+	if t.isError {
+		return true, POLICY_ERROR
+	}
+	if s.latencyThreshold > 0 && t.duration >= s.latencyThreshold {
+		return true, POLICY_LATENCY
+	}
+
+	probability, ok := s.serviceProbabilities[t.service]
+	if !ok {
+		probability = s.probability
+	}
+	h := fnv.New64a()
+	h.Write([]byte(t.id))
+	// Hashing the trace id makes every ingester sample the same traces.
+	if float64(h.Sum64()%10000) >= probability*10000 {
+		return false, POLICY_PROBABILITY
+	}
+
+	if s.rateLimit > 0 && !s.limiterOf(t.service, t.endpoint).allow(now) {
+		return false, POLICY_RATE_LIMIT
+	}
+	return true, POLICY_PROBABILITY
+}
+
+// remember keeps the decision for segments arriving after it was made. The
+// decisions are bounded by the max spans as well.
+func (s *Sampler) remember(traceID string, keep bool, now time.Time) {
+	s.decided[traceID] = keep
+	s.decisions = append(s.decisions, decision{traceID: traceID, keep: keep, expires: now.Add(decisionTTL * s.decisionWait)})
+}
+
+func (s *Sampler) expire(now time.Time) {
+	for len(s.decisions) > 0 && (len(s.decisions) > s.maxSpans || now.After(s.decisions[0].expires)) {
+		delete(s.decided, s.decisions[0].traceID)
+		s.decisions = s.decisions[1:]
+	}
+}
+
+func (s *Sampler) limiterOf(service, endpoint string) *rateLimiter {
+	key := service + "|" + endpoint
+	limiter, ok := s.limiters[key]
+	if !ok {
+		// Forget the limiters of endpoints which are no longer called instead
+		// of growing without bound.
+		if len(s.limiters) >= maxRateLimiters {
+			s.limiters = make(map[string]*rateLimiter)
+		}
+		limiter = newRateLimiter(s.rateLimit)
+		s.limiters[key] = limiter
+	}
+	return limiter
+}
+
+const (
+	// decisionTTL how many decision waits a decision is kept for late segments
+	decisionTTL     = 6
+	maxRateLimiters = 10000
+)
+
+func decisionLabel(keep bool) string {
+	if keep {
+		return "keep"
+	}
+	return "drop"
+}
+
+type span struct {
+	traceID  string
+	service  string
+	endpoint string
+	root     bool
+	isError  bool
+	duration int64
+}
+
+func parseSpans(data *sls.LogGroup) []*span {
+	spans := make([]*span, 0, len(data.Logs))
+	for _, log := range data.Logs {
+		s := &span{}
+		for _, c := range log.Contents {
+			switch c.GetKey() {
+			case converter.TraceIDField:
+				s.traceID = c.GetValue()
+			case converter.ServiceName:
+				s.service = c.GetValue()
+			case converter.OperationName:
+				s.endpoint = c.GetValue()
+			case converter.ParentSpanID:
+				s.root = c.GetValue() == ""
+			case converter.StatusCodeField:
+				s.isError = c.GetValue() == converter.StatusCodeError
+			case converter.Duration:
+				s.duration, _ = strconv.ParseInt(c.GetValue(), 10, 64)
+			}
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func (t *trace) add(s *span) {
+	if (s.root && !t.rooted) || t.service == "" {
+		t.service, t.endpoint, t.rooted = s.service, s.endpoint, s.root
+	}
+	t.isError = t.isError || s.isError
+	if s.duration > t.duration {
+		t.duration = s.duration
+	}
+}
+
+// rateLimiter is a token bucket allowing rate traces per second, with a burst
+// of one second or one trace, whichever is more.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst}
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,145 @@
+package sampler
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aliyun-sls/skywalking-ingester/configure"
+	"github.com/aliyun-sls/skywalking-ingester/converter"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/golang/protobuf/proto"
+)
+
+// testConfiguration overrides the sampling settings, other settings are not
+// read by the sampler.
+type testConfiguration struct {
+	configure.Configuration
+	latencyThreshold time.Duration
+	probability      float64
+	rateLimit        float64
+	maxSpans         int
+}
+
+func (c *testConfiguration) Sampling() bool                          { return true }
+func (c *testConfiguration) SamplingDecisionWait() time.Duration     { return 10 * time.Second }
+func (c *testConfiguration) SamplingLatencyThreshold() time.Duration { return c.latencyThreshold }
+func (c *testConfiguration) SamplingProbability() float64            { return c.probability }
+func (c *testConfiguration) SamplingEndpointRateLimit() float64      { return c.rateLimit }
+func (c *testConfiguration) SamplingMaxSpans() int                   { return c.maxSpans }
+func (c *testConfiguration) SamplingFallback() string                { return configure.SAMPLING_FALLBACK_DROP }
+func (c *testConfiguration) SamplingServiceProbabilities() map[string]float64 {
+	return map[string]float64{"always": 1}
+}
+
+func newSegment(traceID, service, endpoint, statusCode string, duration time.Duration) *sls.LogGroup {
+	content := func(k, v string) *sls.LogContent {
+		return &sls.LogContent{Key: proto.String(k), Value: proto.String(v)}
+	}
+	return &sls.LogGroup{Logs: []*sls.Log{{Contents: []*sls.LogContent{
+		content(converter.TraceIDField, traceID),
+		content(converter.ServiceName, service),
+		content(converter.OperationName, endpoint),
+		content(converter.ParentSpanID, ""),
+		content(converter.StatusCodeField, statusCode),
+		content(converter.Duration, strconv.FormatInt(duration.Microseconds(), 10)),
+	}}}}
+}
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *testConfiguration
+		data   []*sls.LogGroup
+		want   []bool
+		// immediate the number of segments released before the decision wait
+		immediate int
+	}{
+		{
+			name:   "keep errors",
+			config: &testConfiguration{maxSpans: 100},
+			data:   []*sls.LogGroup{newSegment("t1", "order", "/order", "SUCCESS", 0), newSegment("t1", "stock", "/stock", "ERROR", 0)},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "keep slow traces",
+			config: &testConfiguration{maxSpans: 100, latencyThreshold: time.Second},
+			data:   []*sls.LogGroup{newSegment("t1", "order", "/order", "SUCCESS", 2*time.Second), newSegment("t2", "order", "/order", "SUCCESS", 0)},
+			want:   []bool{true, false},
+		},
+		{
+			name:   "service probability",
+			config: &testConfiguration{maxSpans: 100},
+			data:   []*sls.LogGroup{newSegment("t1", "always", "/", "SUCCESS", 0), newSegment("t2", "order", "/", "SUCCESS", 0)},
+			want:   []bool{true, false},
+		},
+		{
+			name:   "endpoint rate limit",
+			config: &testConfiguration{maxSpans: 100, probability: 1, rateLimit: 1},
+			data: []*sls.LogGroup{
+				newSegment("t1", "order", "/order", "SUCCESS", 0),
+				newSegment("t2", "order", "/order", "SUCCESS", 0),
+				newSegment("t3", "order", "/stock", "SUCCESS", 0),
+			},
+			want: []bool{true, false, true},
+		},
+		{
+			name:      "fallback when full",
+			config:    &testConfiguration{maxSpans: 1, probability: 1},
+			data:      []*sls.LogGroup{newSegment("t1", "order", "/order", "SUCCESS", 0), newSegment("t2", "order", "/order", "ERROR", 0)},
+			want:      []bool{true, false},
+			immediate: 1,
+		},
+		{
+			name:   "fallback decides the whole trace",
+			config: &testConfiguration{maxSpans: 2, probability: 1},
+			data: []*sls.LogGroup{
+				newSegment("t1", "order", "/order", "ERROR", 0),
+				newSegment("t2", "order", "/order", "SUCCESS", 0),
+				newSegment("t1", "stock", "/stock", "SUCCESS", 0),
+				newSegment("t1", "user", "/user", "SUCCESS", 0),
+			},
+			want:      []bool{false, true, false, false},
+			immediate: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[int]bool)
+			s := NewSampler(tt.config, func(data *sls.LogGroup, payload interface{}, keep bool) {
+				got[payload.(int)] = keep
+			})
+
+			for i, data := range tt.data {
+				s.Add(data, i)
+			}
+			s.Decide(time.Now(), false)
+			if len(got) != tt.immediate {
+				t.Fatalf("released %v before the decision wait", got)
+			}
+			s.Decide(time.Now().Add(time.Minute), false)
+
+			for i, keep := range tt.want {
+				if k, ok := got[i]; !ok || k != keep {
+					t.Errorf("segment %d keep = %v (released %v), want %v", i, k, ok, keep)
+				}
+			}
+		})
+	}
+}
+
+func TestSamplerLateSegment(t *testing.T) {
+	got := make(map[int]bool)
+	s := NewSampler(&testConfiguration{maxSpans: 100}, func(data *sls.LogGroup, payload interface{}, keep bool) {
+		got[payload.(int)] = keep
+	})
+
+	s.Add(newSegment("t1", "order", "/order", "ERROR", 0), 0)
+	s.Decide(time.Now().Add(time.Minute), false)
+	s.Add(newSegment("t1", "stock", "/stock", "SUCCESS", 0), 1)
+
+	if !got[0] || !got[1] {
+		t.Errorf("released %v, want the late segment to follow the kept trace", got)
+	}
+}